@@ -0,0 +1,449 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/blockloop/scan/v2"
+)
+
+// pkTag tags the primary key fields of a struct, e.g. `db:"id" pk:"true"`.
+const pkTag = "pk"
+
+// structRow is a struct mapped to columns as with scan.Columns, from its db tags or field names.
+type structRow struct {
+	value   reflect.Value
+	columns []string
+	values  []any
+	// keys are the indexes of the primary key fields by column.
+	keys map[string][]int
+}
+
+func newStructRow(v any) (*structRow, error) {
+	columns, err := scan.Columns(v)
+	if err != nil {
+		return nil, err
+	}
+	values, err := scan.Values(columns, v)
+	if err != nil {
+		return nil, err
+	}
+
+	value := reflect.ValueOf(v).Elem()
+	return &structRow{
+		value:   value,
+		columns: columns,
+		values:  values,
+		keys:    primaryKeys(value.Type(), nil),
+	}, nil
+}
+
+// primaryKeys returns the indexes of the fields of t tagged with pk:"true" by column.
+func primaryKeys(t reflect.Type, index []int) map[string][]int {
+	keys := make(map[string][]int)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		fieldIndex := append(append([]int(nil), index...), i)
+		if f.Type.Kind() == reflect.Struct {
+			for column, j := range primaryKeys(f.Type, fieldIndex) {
+				keys[column] = j
+			}
+		}
+
+		if pk, _ := strconv.ParseBool(f.Tag.Get(pkTag)); !pk {
+			continue
+		}
+		column := scan.ColumnsMapper(f.Name)
+		if tag, ok := f.Tag.Lookup("db"); ok && tag != "" && tag != "-" {
+			column = tag
+		}
+		keys[column] = fieldIndex
+	}
+	return keys
+}
+
+// isKey reports whether column is a primary key.
+func (r *structRow) isKey(column string) bool {
+	_, ok := r.keys[column]
+	return ok
+}
+
+// zeroKey reports whether column is a primary key with a zero value, to be generated by the database.
+func (r *structRow) zeroKey(column string) bool {
+	i, ok := r.keys[column]
+	return ok && r.value.FieldByIndex(i).IsZero()
+}
+
+// key returns the field of the primary key column.
+func (r *structRow) key(column string) reflect.Value {
+	return r.value.FieldByIndex(r.keys[column])
+}
+
+// setKey sets the primary key column to a generated id, if it is an integer.
+func (r *structRow) setKey(column string, id int64) {
+	f := r.key(column)
+	switch f.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		f.SetInt(id)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		f.SetUint(uint64(id))
+	}
+}
+
+// id returns the primary key of the row if it is a single integer, or 0.
+func (r *structRow) id() int64 {
+	if len(r.keys) != 1 {
+		return 0
+	}
+	for column := range r.keys {
+		f := r.key(column)
+		switch f.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return f.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return int64(f.Uint())
+		}
+	}
+	return 0
+}
+
+// inserted returns the indexes of the columns inserted, all but the zero primary keys.
+func (r *structRow) inserted() []int {
+	var columns []int
+	for i, column := range r.columns {
+		if !r.zeroKey(column) {
+			columns = append(columns, i)
+		}
+	}
+	return columns
+}
+
+// split splits the columns and values of the row into the primary keys and the others.
+func (r *structRow) split() (columns []string, values []any, keys []string, keyValues []any) {
+	for i, column := range r.columns {
+		if r.isKey(column) {
+			keys = append(keys, column)
+			keyValues = append(keyValues, r.values[i])
+		} else {
+			columns = append(columns, column)
+			values = append(values, r.values[i])
+		}
+	}
+	return columns, values, keys, keyValues
+}
+
+// InsertStruct is a helper function that inserts a struct into table, the columns are its db tags as with scan.Columns.
+// Primary key fields, tagged with pk:"true", are not inserted if they are zero so that the database generates them,
+// the generated id is returned and set to the field. The statement is built for SQLite, see Dialect.InsertStruct.
+func InsertStruct(ctx context.Context, db Querier, table string, v any) (int64, error) {
+	return SQLite.InsertStruct(ctx, db, table, v)
+}
+
+// InsertStruct inserts a struct into table with a statement of the dialect, see InsertStruct.
+//
+// With PostgreSQL, a single generated key is returned by the statement and scanned into its field, so that it may
+// also be a UUID or a string; the id returned is the primary key if it is a single integer, or 0.
+func (d Dialect) InsertStruct(ctx context.Context, db Querier, table string, v any) (int64, error) {
+	row, err := newStructRow(v)
+	if err != nil {
+		return 0, err
+	}
+
+	var columns, generated []string
+	var values []any
+	for i, column := range row.columns {
+		if row.zeroKey(column) {
+			generated = append(generated, column)
+			continue
+		}
+		columns = append(columns, column)
+		values = append(values, row.values[i])
+	}
+
+	if len(columns) == 0 {
+		return 0, fmt.Errorf("db: %T has no column to insert", v)
+	}
+	query := d.insertSQL(table, columns, 1)
+
+	// LastInsertId is not supported by PostgreSQL drivers
+	if d == PostgreSQL {
+		if len(generated) == 1 {
+			f := row.key(generated[0])
+			key := reflect.New(f.Type())
+			if err := db.QueryRowContext(ctx, query+" RETURNING "+d.Quote(generated[0]), values...).Scan(key.Interface()); err != nil {
+				return 0, err
+			}
+			f.Set(key.Elem())
+		} else if _, err := db.ExecContext(ctx, query, values...); err != nil {
+			return 0, err
+		}
+		return row.id(), nil
+	}
+
+	id, err := Insert(ctx, db, query, values...)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(generated) == 1 {
+		row.setKey(generated[0], id)
+	}
+	return id, nil
+}
+
+// UpdateStruct is a helper function that updates the row of table with the primary key of a struct,
+// its fields tagged with pk:"true", to the other fields of the struct. It returns the number of rows affected.
+// The statement is built for SQLite, see Dialect.UpdateStruct.
+func UpdateStruct(ctx context.Context, db Querier, table string, v any) (int64, error) {
+	return SQLite.UpdateStruct(ctx, db, table, v)
+}
+
+// UpdateStruct updates the row of table with the primary key of a struct with a statement of the dialect,
+// see UpdateStruct.
+func (d Dialect) UpdateStruct(ctx context.Context, db Querier, table string, v any) (int64, error) {
+	row, err := newStructRow(v)
+	if err != nil {
+		return 0, err
+	}
+
+	columns, values, keys, keyValues := row.split()
+	if len(keys) == 0 {
+		return 0, fmt.Errorf("db: %T has no primary key field tagged with %s:\"true\"", v, pkTag)
+	}
+	if len(columns) == 0 {
+		return 0, fmt.Errorf("db: %T has no column to update", v)
+	}
+
+	query := d.updateSQL(table, columns, keys)
+
+	return Update(ctx, db, query, append(values, keyValues...)...)
+}
+
+// UpsertStruct is a helper function that inserts a struct into table, or updates the row with its primary key
+// if it exists, see InsertStruct and UpdateStruct. It returns the number of rows affected as reported by the driver.
+// The statement is built for SQLite, see Dialect.UpsertStruct.
+func UpsertStruct(ctx context.Context, db Querier, table string, v any) (int64, error) {
+	return SQLite.UpsertStruct(ctx, db, table, v)
+}
+
+// UpsertStruct inserts or updates a struct with a statement of the dialect, see UpsertStruct.
+// Upserts are not supported with SQL Server and Oracle.
+func (d Dialect) UpsertStruct(ctx context.Context, db Querier, table string, v any) (int64, error) {
+	row, err := newStructRow(v)
+	if err != nil {
+		return 0, err
+	}
+
+	columns, values, keys, keyValues := row.split()
+	if len(keys) == 0 {
+		return 0, fmt.Errorf("db: %T has no primary key field tagged with %s:\"true\"", v, pkTag)
+	}
+
+	if d == SQLServer || d == Oracle {
+		return 0, fmt.Errorf("db: upsert is not supported with %s", d)
+	}
+
+	query := d.upsertSQL(table, keys, columns)
+
+	return Update(ctx, db, query, append(keyValues, values...)...)
+}
+
+// BulkInsert is a helper function that inserts rows into table, see InsertStruct. T is a struct or a pointer to a struct.
+// Zero primary key fields are not inserted, consecutive rows with the same zero keys are inserted together in as few
+// statements as the limit of arguments of a statement allows. The rows are inserted in a transaction, or a savepoint
+// if db is a *sql.Tx, so that all the rows are inserted or none. It returns the number of rows inserted.
+// Unlike InsertStruct, the keys generated by the database are not set to the rows: drivers do not report
+// the ids of the rows of a statement. The statements are built for SQLite, see Dialect.BulkInsert.
+func BulkInsert[T any](ctx context.Context, db Querier, table string, rows []T) (int64, error) {
+	return SQLite.BulkInsert(ctx, db, table, rows)
+}
+
+// BulkInsert inserts rows into table with statements of the dialect, see BulkInsert.
+// rows is a slice of structs or of pointers to structs.
+func (d Dialect) BulkInsert(ctx context.Context, db Querier, table string, rows any) (int64, error) {
+	slice := reflect.ValueOf(rows)
+	if slice.Kind() != reflect.Slice {
+		return 0, fmt.Errorf("db: %T is not a slice", rows)
+	}
+	if slice.Len() == 0 {
+		return 0, nil
+	}
+
+	structRows := make([]*structRow, slice.Len())
+	for i := range structRows {
+		elem := slice.Index(i)
+		if elem.Kind() != reflect.Pointer {
+			elem = elem.Addr()
+		}
+
+		row, err := newStructRow(elem.Interface())
+		if err != nil {
+			return 0, err
+		}
+		structRows[i] = row
+	}
+
+	var inserted int64
+	err := Tx(ctx, db, func(tx *sql.Tx, ctx context.Context) error {
+		for start := 0; start < len(structRows); {
+			// a generated key is omitted, a key set is inserted, they can not be mixed in a statement
+			columns := structRows[start].inserted()
+			end := start + 1
+			for end < len(structRows) && slices.Equal(structRows[end].inserted(), columns) {
+				end++
+			}
+
+			n, err := d.insertRows(ctx, tx, table, structRows[start:end], columns)
+			if err != nil {
+				return err
+			}
+			inserted += n
+			start = end
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return inserted, nil
+}
+
+// insertRows inserts the columns of rows into table, in as few statements as the limit of arguments allows.
+func (d Dialect) insertRows(ctx context.Context, tx *sql.Tx, table string, rows []*structRow, columns []int) (int64, error) {
+	if len(columns) == 0 {
+		return 0, fmt.Errorf("db: %s has no column to insert", rows[0].value.Type())
+	}
+
+	names := make([]string, len(columns))
+	for i, j := range columns {
+		names[i] = rows[0].columns[j]
+	}
+
+	chunk := max(1, d.maxParams()/max(1, len(columns)))
+
+	var inserted int64
+	for start := 0; start < len(rows); start += chunk {
+		end := min(start+chunk, len(rows))
+
+		values := make([]any, 0, (end-start)*len(columns))
+		for _, row := range rows[start:end] {
+			for _, j := range columns {
+				values = append(values, row.values[j])
+			}
+		}
+
+		n, err := Update(ctx, tx, d.insertSQL(table, names, end-start), values...)
+		if err != nil {
+			return 0, err
+		}
+		inserted += n
+	}
+
+	return inserted, nil
+}
+
+// insertSQL builds an INSERT statement of rows rows of columns.
+func (d Dialect) insertSQL(table string, columns []string, rows int) string {
+	var b strings.Builder
+
+	b.WriteString("INSERT INTO " + table + " (" + d.quoteAll(columns) + ") VALUES ")
+	n := 0
+	for i := 0; i < rows; i++ {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString("(")
+		for j := range columns {
+			if j > 0 {
+				b.WriteString(", ")
+			}
+			n++
+			b.WriteString(d.Placeholder(n))
+		}
+		b.WriteString(")")
+	}
+
+	return b.String()
+}
+
+// updateSQL builds an UPDATE statement of columns of the row with keys, the arguments are the columns then the keys.
+func (d Dialect) updateSQL(table string, columns, keys []string) string {
+	var b strings.Builder
+
+	b.WriteString("UPDATE " + table + " SET ")
+	n := 0
+	for i, column := range columns {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		n++
+		b.WriteString(d.Quote(column) + " = " + d.Placeholder(n))
+	}
+
+	b.WriteString(" WHERE ")
+	for i, key := range keys {
+		if i > 0 {
+			b.WriteString(" AND ")
+		}
+		n++
+		b.WriteString(d.Quote(key) + " = " + d.Placeholder(n))
+	}
+
+	return b.String()
+}
+
+// upsertSQL builds an INSERT statement of keys and columns updating columns on a conflict of keys,
+// the arguments are the keys then the columns.
+func (d Dialect) upsertSQL(table string, keys, columns []string) string {
+	var b strings.Builder
+
+	b.WriteString(d.insertSQL(table, append(append([]string(nil), keys...), columns...), 1))
+
+	if d == MySQL {
+		b.WriteString(" ON DUPLICATE KEY UPDATE ")
+		if len(columns) == 0 {
+			// a no-op update ignores the conflict
+			b.WriteString(d.Quote(keys[0]) + " = " + d.Quote(keys[0]))
+		}
+		for i, column := range columns {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(d.Quote(column) + " = VALUES(" + d.Quote(column) + ")")
+		}
+		return b.String()
+	}
+
+	b.WriteString(" ON CONFLICT (" + d.quoteAll(keys) + ") ")
+	if len(columns) == 0 {
+		b.WriteString("DO NOTHING")
+		return b.String()
+	}
+	b.WriteString("DO UPDATE SET ")
+	for i, column := range columns {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(d.Quote(column) + " = excluded." + d.Quote(column))
+	}
+
+	return b.String()
+}
+
+func (d Dialect) quoteAll(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = d.Quote(name)
+	}
+	return strings.Join(quoted, ", ")
+}
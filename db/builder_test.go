@@ -0,0 +1,235 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type account struct {
+	ID      int64  `db:"id" pk:"true"`
+	Email   string `db:"email"`
+	Balance int    `db:"balance"`
+	Note    string `db:"-"`
+}
+
+func accountsDB(t *testing.T) *sql.DB {
+	db := mustDB(t, `CREATE TABLE accounts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		email VARCHAR(120) NOT NULL UNIQUE,
+		balance INTEGER NOT NULL DEFAULT 0
+	);`)
+	// every connection opens its own in-memory database
+	db.SetMaxOpenConns(1)
+	return db
+}
+
+func TestInsertStruct(t *testing.T) {
+	db := accountsDB(t)
+	ctx := context.Background()
+
+	a := account{Email: "alice@example.com", Balance: 10}
+	id, err := InsertStruct(ctx, db, "accounts", &a)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), id)
+	assert.Equal(t, int64(1), a.ID, "the generated id is set")
+
+	b := account{ID: 10, Email: "bob@example.com"}
+	id, err = InsertStruct(ctx, db, "accounts", &b)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), id)
+
+	_, err = InsertStruct(ctx, db, "accounts", a)
+	assert.Error(t, err, "a struct must be passed by pointer")
+
+	accounts, err := Rows[account](ctx, db, "SELECT * FROM accounts ORDER BY id")
+	require.NoError(t, err)
+	assert.Equal(t, []account{a, b}, accounts)
+}
+
+type apiToken struct {
+	ID   string `db:"id" pk:"true"`
+	Name string `db:"name"`
+}
+
+func TestInsertStruct_PostgreSQL(t *testing.T) {
+	// SQLite also runs the PostgreSQL placeholders and RETURNING clause
+	db := accountsDB(t)
+	_, err := db.Exec(`CREATE TABLE tokens (id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(16)))), name TEXT NOT NULL)`)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	a := account{Email: "alice@example.com", Balance: 10}
+	id, err := PostgreSQL.InsertStruct(ctx, db, "accounts", &a)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), id)
+	assert.Equal(t, int64(1), a.ID, "the generated id is set")
+
+	// no generated key, LastInsertId is not used
+	id, err = PostgreSQL.InsertStruct(ctx, db, "accounts", &account{ID: 10, Email: "bob@example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), id)
+
+	tok := apiToken{Name: "api"}
+	id, err = PostgreSQL.InsertStruct(ctx, db, "tokens", &tok)
+	require.NoError(t, err)
+	assert.Zero(t, id, "the key is not an integer")
+	assert.Len(t, tok.ID, 32, "the generated key is set")
+
+	got, err := RowDialect[apiToken](ctx, db, PostgreSQL, "SELECT * FROM tokens WHERE id = $1", tok.ID)
+	require.NoError(t, err)
+	assert.Equal(t, tok, got)
+}
+
+func TestUpdateStruct(t *testing.T) {
+	db := accountsDB(t)
+	ctx := context.Background()
+
+	a := account{Email: "alice@example.com", Balance: 10}
+	_, err := InsertStruct(ctx, db, "accounts", &a)
+	require.NoError(t, err)
+
+	a.Balance = 20
+	affected, err := UpdateStruct(ctx, db, "accounts", &a)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), affected)
+
+	affected, err = UpdateStruct(ctx, db, "accounts", &account{ID: 2, Email: "bob@example.com"})
+	require.NoError(t, err)
+	assert.Zero(t, affected)
+
+	_, err = UpdateStruct(ctx, db, "persons", &person{ID: 1, Name: "brett"})
+	assert.ErrorContains(t, err, "no primary key")
+
+	got, err := Row[account](ctx, db, "SELECT * FROM accounts WHERE id = ?", a.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 20, got.Balance)
+}
+
+func TestUpsertStruct(t *testing.T) {
+	db := accountsDB(t)
+	ctx := context.Background()
+
+	_, err := UpsertStruct(ctx, db, "accounts", &account{ID: 1, Email: "alice@example.com", Balance: 10})
+	require.NoError(t, err)
+	_, err = UpsertStruct(ctx, db, "accounts", &account{ID: 1, Email: "alice@example.org", Balance: 20})
+	require.NoError(t, err)
+
+	accounts, err := Rows[account](ctx, db, "SELECT * FROM accounts")
+	require.NoError(t, err)
+	assert.Equal(t, []account{{ID: 1, Email: "alice@example.org", Balance: 20}}, accounts)
+
+	_, err = SQLServer.UpsertStruct(ctx, db, "accounts", &accounts[0])
+	assert.ErrorContains(t, err, "not supported")
+}
+
+func TestBulkInsert(t *testing.T) {
+	db := accountsDB(t)
+	ctx := context.Background()
+
+	// more rows than the arguments of a statement allow
+	accounts := make([]account, 1200)
+	for i := range accounts {
+		accounts[i] = account{Email: fmt.Sprintf("user%d@example.com", i), Balance: i}
+	}
+	inserted, err := BulkInsert(ctx, db, "accounts", accounts)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1200), inserted)
+
+	count, err := Count(ctx, db, "SELECT count(*) FROM accounts")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1200), count)
+
+	// a duplicate rolls back all the rows
+	_, err = BulkInsert(ctx, db, "accounts", []*account{
+		{ID: 2000, Email: "new@example.com"},
+		{ID: 2001, Email: "user0@example.com"},
+	})
+	assert.Error(t, err)
+
+	count, err = Count(ctx, db, "SELECT count(*) FROM accounts")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1200), count)
+}
+
+func TestBulkInsert_MixedKeys(t *testing.T) {
+	db := accountsDB(t)
+	ctx := context.Background()
+
+	// generated and set keys are inserted by separate statements, in order
+	inserted, err := BulkInsert(ctx, db, "accounts", []account{
+		{Email: "alice@example.com"},
+		{ID: 100, Email: "bob@example.com"},
+		{ID: 101, Email: "carol@example.com"},
+		{Email: "dave@example.com"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), inserted)
+
+	ids, err := Rows[int64](ctx, db, "SELECT id FROM accounts ORDER BY email")
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 100, 101, 102}, ids)
+
+	_, err = SQLite.BulkInsert(ctx, db, "accounts", account{Email: "eve@example.com"})
+	assert.ErrorContains(t, err, "not a slice")
+
+	// a row of a generated key only has no column to insert
+	type counter struct {
+		ID int64 `db:"id" pk:"true"`
+	}
+	_, err = db.Exec("CREATE TABLE counters (id INTEGER PRIMARY KEY AUTOINCREMENT)")
+	require.NoError(t, err)
+	_, err = BulkInsert(ctx, db, "counters", []counter{{ID: 1}, {}})
+	assert.ErrorContains(t, err, "no column to insert")
+	count, err := Count(ctx, db, "SELECT count(*) FROM counters")
+	require.NoError(t, err)
+	assert.Zero(t, count, "the rows inserted are rolled back")
+	_, err = InsertStruct(ctx, db, "counters", &counter{})
+	assert.ErrorContains(t, err, "no column to insert")
+}
+
+func TestDialect_SQL(t *testing.T) {
+	columns := []string{"email", "balance"}
+	keys := []string{"id"}
+
+	tests := []struct {
+		dialect Dialect
+		insert  string
+		update  string
+		upsert  string
+	}{
+		{
+			dialect: SQLite,
+			insert:  `INSERT INTO accounts ("email", "balance") VALUES (?, ?), (?, ?)`,
+			update:  `UPDATE accounts SET "email" = ?, "balance" = ? WHERE "id" = ?`,
+			upsert:  `INSERT INTO accounts ("id", "email", "balance") VALUES (?, ?, ?) ON CONFLICT ("id") DO UPDATE SET "email" = excluded."email", "balance" = excluded."balance"`,
+		},
+		{
+			dialect: MySQL,
+			insert:  "INSERT INTO accounts (`email`, `balance`) VALUES (?, ?), (?, ?)",
+			update:  "UPDATE accounts SET `email` = ?, `balance` = ? WHERE `id` = ?",
+			upsert:  "INSERT INTO accounts (`id`, `email`, `balance`) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE `email` = VALUES(`email`), `balance` = VALUES(`balance`)",
+		},
+		{
+			dialect: PostgreSQL,
+			insert:  `INSERT INTO accounts ("email", "balance") VALUES ($1, $2), ($3, $4)`,
+			update:  `UPDATE accounts SET "email" = $1, "balance" = $2 WHERE "id" = $3`,
+			upsert:  `INSERT INTO accounts ("id", "email", "balance") VALUES ($1, $2, $3) ON CONFLICT ("id") DO UPDATE SET "email" = excluded."email", "balance" = excluded."balance"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dialect.String(), func(t *testing.T) {
+			assert.Equal(t, tt.insert, tt.dialect.insertSQL("accounts", columns, 2))
+			assert.Equal(t, tt.update, tt.dialect.updateSQL("accounts", columns, keys))
+			assert.Equal(t, tt.upsert, tt.dialect.upsertSQL("accounts", keys, columns))
+		})
+	}
+
+	assert.Equal(t, `"a""b"`, PostgreSQL.Quote(`a"b`))
+	assert.Equal(t, `INSERT INTO t ("id") VALUES (?) ON CONFLICT ("id") DO NOTHING`, SQLite.upsertSQL("t", keys, nil))
+}
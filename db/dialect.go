@@ -0,0 +1,184 @@
+package db
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Dialect is the SQL dialect of a database, it determines the placeholders, the quoting of identifiers
+// and the syntax of the statements built by the helpers.
+type Dialect int
+
+const (
+	// SQLite uses ? placeholders and "quoted" identifiers.
+	SQLite Dialect = iota
+	// MySQL uses ? placeholders and `quoted` identifiers.
+	MySQL
+	// PostgreSQL uses $1, $2... placeholders and "quoted" identifiers.
+	PostgreSQL
+	// SQLServer uses @p1, @p2... placeholders and "quoted" identifiers.
+	SQLServer
+	// Oracle uses :1, :2... placeholders and "quoted" identifiers.
+	Oracle
+)
+
+// String returns the name of the dialect.
+func (d Dialect) String() string {
+	switch d {
+	case SQLite:
+		return "sqlite"
+	case MySQL:
+		return "mysql"
+	case PostgreSQL:
+		return "postgres"
+	case SQLServer:
+		return "sqlserver"
+	case Oracle:
+		return "oracle"
+	default:
+		return "dialect(" + strconv.Itoa(int(d)) + ")"
+	}
+}
+
+// Placeholder returns the placeholder of the n-th argument of a statement, starting at 1.
+func (d Dialect) Placeholder(n int) string {
+	switch d {
+	case PostgreSQL:
+		return "$" + strconv.Itoa(n)
+	case SQLServer:
+		return "@p" + strconv.Itoa(n)
+	case Oracle:
+		return ":" + strconv.Itoa(n)
+	default:
+		return "?"
+	}
+}
+
+// Quote quotes an identifier such as a column name.
+func (d Dialect) Quote(name string) string {
+	q := `"`
+	if d == MySQL {
+		q = "`"
+	}
+	return q + strings.ReplaceAll(name, q, q+q) + q
+}
+
+// maxParams is the maximum number of arguments of a statement.
+func (d Dialect) maxParams() int {
+	switch d {
+	case SQLite:
+		// SQLITE_MAX_VARIABLE_NUMBER before SQLite 3.32.0
+		return 999
+	case SQLServer:
+		return 2100
+	default:
+		return 65535
+	}
+}
+
+// limitOne limits a query to one row, unless it has a top-level LIMIT, FETCH, OFFSET or TOP clause
+// or it is not a query, see isQuery. The limit precedes the locking clause of the query, if any,
+// as FOR UPDATE must follow LIMIT.
+//
+// Queries the dialect can not limit are left unchanged: SQL Server queries combined with UNION, INTERSECT
+// or EXCEPT, as TOP only limits their first SELECT, and Oracle locking queries, as FOR UPDATE can not be
+// used with FETCH FIRST (ORA-02014).
+func (d Dialect) limitOne(query string) string {
+	toks := d.lex(query)
+	if !isQuery(toks) {
+		return query
+	}
+
+	selects, locking := -1, -1
+	for i, t := range toks {
+		switch {
+		case t.is("SELECT"):
+			if selects < 0 {
+				selects = i
+			}
+		case t.is("LIMIT"), t.is("OFFSET"),
+			t.is("FETCH") && i+1 < len(toks) && (toks[i+1].is("FIRST") || toks[i+1].is("NEXT")),
+			t.is("TOP") && i > 0 && i+1 < len(toks) && toks[i+1].kind == tokPunct &&
+				(toks[i-1].is("SELECT") || toks[i-1].is("DISTINCT") || toks[i-1].is("ALL")):
+			return query
+		case d == SQLServer && (t.is("UNION") || t.is("INTERSECT") || t.is("EXCEPT")):
+			return query
+		case locking < 0 && i+1 < len(toks) && isLockingClause(t, toks[i+1]):
+			locking = i
+		}
+	}
+	if selects < 0 || d == Oracle && locking >= 0 {
+		return query
+	}
+
+	if d == SQLServer {
+		// TOP follows SELECT and DISTINCT or ALL
+		i := selects
+		if i+1 < len(toks) && (toks[i+1].is("DISTINCT") || toks[i+1].is("ALL")) {
+			i++
+		}
+		return query[:toks[i].end] + " TOP 1" + query[toks[i].end:]
+	}
+
+	clause := "LIMIT 1"
+	if d == Oracle {
+		clause = "FETCH FIRST 1 ROWS ONLY"
+	}
+
+	if locking >= 0 {
+		t := toks[locking]
+		return query[:t.start] + clause + " " + query[t.start:]
+	}
+
+	// the limit follows the last token, not a trailing comment or semicolon
+	end := len(toks)
+	for end > 0 && toks[end-1].kind == tokPunct && toks[end-1].text == ";" {
+		end--
+	}
+	pos := toks[end-1].end
+	return query[:pos] + " " + clause + query[pos:]
+}
+
+// isQuery reports whether a statement is a query: its first keyword, after any opening parentheses, is SELECT,
+// or WITH followed by a SELECT. INSERT ... SELECT is not a query.
+func isQuery(toks []token) bool {
+	i := 0
+	for i < len(toks) && toks[i].kind == tokPunct && toks[i].text == "(" {
+		i++
+	}
+	if i == len(toks) || toks[i].kind != tokWord {
+		return false
+	}
+
+	switch toks[i].text {
+	case "SELECT":
+		return true
+	case "WITH":
+		// the main statement follows the common table expressions, which are in parentheses
+		for _, t := range toks[i+1:] {
+			if t.kind != tokWord || t.depth != toks[i].depth {
+				continue
+			}
+			switch t.text {
+			case "SELECT":
+				return true
+			case "INSERT", "UPDATE", "DELETE", "MERGE":
+				return false
+			}
+		}
+	}
+	return false
+}
+
+// isLockingClause reports whether the tokens t, next start a locking clause:
+// FOR UPDATE, FOR SHARE, FOR NO KEY UPDATE, FOR KEY SHARE or LOCK IN SHARE MODE.
+func isLockingClause(t, next token) bool {
+	switch {
+	case t.is("FOR"):
+		return next.is("UPDATE") || next.is("SHARE") || next.is("NO") || next.is("KEY")
+	case t.is("LOCK"):
+		return next.is("IN")
+	default:
+		return false
+	}
+}
@@ -0,0 +1,58 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDialect_limitOne(t *testing.T) {
+	tests := []struct {
+		dialect Dialect
+		query   string
+		want    string
+	}{
+		{SQLite, "SELECT * FROM t", "SELECT * FROM t LIMIT 1"},
+		{SQLite, "SELECT * FROM t LIMIT 5", "SELECT * FROM t LIMIT 5"},
+		{SQLite, "select * from t limit ?", "select * from t limit ?"},
+		{SQLite, "SELECT limit_count FROM quotas", "SELECT limit_count FROM quotas LIMIT 1"},
+		{SQLite, "SELECT * FROM t WHERE note = 'no LIMIT here'", "SELECT * FROM t WHERE note = 'no LIMIT here' LIMIT 1"},
+		{SQLite, `SELECT "limit" FROM t`, `SELECT "limit" FROM t LIMIT 1`},
+		{SQLite, "SELECT * FROM t WHERE id IN (SELECT id FROM u LIMIT 3)", "SELECT * FROM t WHERE id IN (SELECT id FROM u LIMIT 3) LIMIT 1"},
+		{SQLite, "WITH x AS (SELECT * FROM t LIMIT 2) SELECT * FROM x", "WITH x AS (SELECT * FROM t LIMIT 2) SELECT * FROM x LIMIT 1"},
+		{SQLite, "SELECT * FROM t -- first LIMIT", "SELECT * FROM t LIMIT 1 -- first LIMIT"},
+		{SQLite, "SELECT * FROM t /* LIMIT */;", "SELECT * FROM t LIMIT 1 /* LIMIT */;"},
+		{SQLite, "INSERT INTO t (name) VALUES (?) RETURNING id", "INSERT INTO t (name) VALUES (?) RETURNING id"},
+		{MySQL, "SELECT * FROM t WHERE id = ? FOR UPDATE", "SELECT * FROM t WHERE id = ? LIMIT 1 FOR UPDATE"},
+		{MySQL, "SELECT * FROM t LOCK IN SHARE MODE", "SELECT * FROM t LIMIT 1 LOCK IN SHARE MODE"},
+		{MySQL, `SELECT * FROM t WHERE s = 'it\'s FOR UPDATE'`, `SELECT * FROM t WHERE s = 'it\'s FOR UPDATE' LIMIT 1`},
+		{PostgreSQL, "SELECT * FROM t FOR NO KEY UPDATE SKIP LOCKED", "SELECT * FROM t LIMIT 1 FOR NO KEY UPDATE SKIP LOCKED"},
+		{PostgreSQL, "SELECT $$ LIMIT $$, $1 FROM t", "SELECT $$ LIMIT $$, $1 FROM t LIMIT 1"},
+		{PostgreSQL, "SELECT * FROM t FETCH FIRST 3 ROWS ONLY", "SELECT * FROM t FETCH FIRST 3 ROWS ONLY"},
+		{SQLServer, "SELECT * FROM t ORDER BY id", "SELECT TOP 1 * FROM t ORDER BY id"},
+		{SQLServer, "SELECT DISTINCT name FROM t", "SELECT DISTINCT TOP 1 name FROM t"},
+		{SQLServer, "SELECT TOP 5 * FROM t", "SELECT TOP 5 * FROM t"},
+		{SQLServer, "SELECT TOP (?) * FROM [limit]", "SELECT TOP (?) * FROM [limit]"},
+		{SQLite, "SELECT top FROM t", "SELECT top FROM t LIMIT 1"},
+		{SQLServer, "SELECT * FROM t ORDER BY id OFFSET 0 ROWS FETCH NEXT 1 ROWS ONLY", "SELECT * FROM t ORDER BY id OFFSET 0 ROWS FETCH NEXT 1 ROWS ONLY"},
+		{Oracle, "SELECT * FROM t", "SELECT * FROM t FETCH FIRST 1 ROWS ONLY"},
+		{Oracle, "SELECT * FROM t WHERE id = :1 FOR UPDATE", "SELECT * FROM t WHERE id = :1 FOR UPDATE"},
+		{Oracle, "SELECT * FROM t ORDER BY id OFFSET 10 ROWS", "SELECT * FROM t ORDER BY id OFFSET 10 ROWS"},
+		{SQLServer, "SELECT * FROM t ORDER BY id OFFSET 10 ROWS", "SELECT * FROM t ORDER BY id OFFSET 10 ROWS"},
+		{SQLServer, "SELECT id FROM t UNION SELECT id FROM u", "SELECT id FROM t UNION SELECT id FROM u"},
+		{SQLServer, "SELECT id FROM t WHERE id IN (SELECT id FROM u EXCEPT SELECT id FROM v)", "SELECT TOP 1 id FROM t WHERE id IN (SELECT id FROM u EXCEPT SELECT id FROM v)"},
+		{SQLite, "SELECT id FROM t UNION SELECT id FROM u", "SELECT id FROM t UNION SELECT id FROM u LIMIT 1"},
+		{PostgreSQL, `SELECT * FROM t WHERE s = E'it\'s' LIMIT 5`, `SELECT * FROM t WHERE s = E'it\'s' LIMIT 5`},
+		{PostgreSQL, `SELECT * FROM t WHERE s = e'\\' || 'LIMIT'`, `SELECT * FROM t WHERE s = e'\\' || 'LIMIT' LIMIT 1`},
+		{PostgreSQL, "SELECT e FROM t", "SELECT e FROM t LIMIT 1"},
+		{SQLite, "INSERT INTO t SELECT * FROM u RETURNING id", "INSERT INTO t SELECT * FROM u RETURNING id"},
+		{SQLServer, "INSERT INTO t SELECT * FROM u", "INSERT INTO t SELECT * FROM u"},
+		{PostgreSQL, "WITH x AS (SELECT * FROM u) INSERT INTO t SELECT * FROM x", "WITH x AS (SELECT * FROM u) INSERT INTO t SELECT * FROM x"},
+		{SQLServer, "WITH x AS (SELECT * FROM u) SELECT * FROM x", "WITH x AS (SELECT * FROM u) SELECT TOP 1 * FROM x"},
+		{SQLite, "UPDATE t SET n = (SELECT max(n) FROM u)", "UPDATE t SET n = (SELECT max(n) FROM u)"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.dialect.limitOne(tt.query), "%s: %s", tt.dialect, tt.query)
+	}
+}
@@ -3,15 +3,40 @@ package db
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"iter"
 	"strings"
+	"sync/atomic"
 
 	"github.com/blockloop/scan/v2"
 )
 
+// Querier runs queries, it is satisfied by *sql.DB, *sql.Tx and *sql.Conn
+// so that the helpers can run inside or outside a transaction.
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// TxBeginner begins transactions, it is satisfied by *sql.DB and *sql.Conn.
+type TxBeginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+var (
+	_ Querier    = (*sql.DB)(nil)
+	_ Querier    = (*sql.Tx)(nil)
+	_ Querier    = (*sql.Conn)(nil)
+	_ TxBeginner = (*sql.DB)(nil)
+	_ TxBeginner = (*sql.Conn)(nil)
+)
+
 // Rows is a helper function that wraps sql rows to scan into a slice.
 // Rows scans structs based on their db tag, and scan any fields not tagged with the db tag matched column name,
 // So had better to tag all fields with db tag to avoid unexpected behavior.
-func Rows[T any](ctx context.Context, db *sql.DB, query string, args ...any) ([]T, error) {
+func Rows[T any](ctx context.Context, db Querier, query string, args ...any) ([]T, error) {
 	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
@@ -23,31 +48,113 @@ func Rows[T any](ctx context.Context, db *sql.DB, query string, args ...any) ([]
 	return result, err
 }
 
+// Iter is a helper function that scans sql rows lazily, one row per iteration, so that large results are
+// not loaded in memory. Rows are scanned as with Rows.
+// The rows are closed when the iteration ends, also when the loop breaks early. An error of the query
+// or of a row is yielded with the zero value of T, and ends the iteration.
+func Iter[T any](ctx context.Context, db Querier, query string, args ...any) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+
+		rows, err := db.QueryContext(ctx, query, args...)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var result T
+			if err := scan.Row(&result, &singleRow{Rows: rows}); err != nil {
+				yield(zero, err)
+				return
+			}
+
+			if !yield(result, nil) {
+				return
+			}
+		}
+
+		if err := rows.Err(); err != nil {
+			yield(zero, err)
+		}
+	}
+}
+
+// IterChan is a helper function that scans sql rows lazily into a channel, for pipelines such as chanx.Batch.
+// The channel of rows is closed when all the rows are sent or ctx is done, then the channel of errors
+// receives the error of the query, of a row or of ctx, if any, and is closed.
+// The caller must read all the rows or cancel ctx to release the rows.
+func IterChan[T any](ctx context.Context, db Querier, query string, args ...any) (<-chan T, <-chan error) {
+	ch := make(chan T)
+	errc := make(chan error, 1)
+
+	go func() {
+		defer close(errc)
+		defer close(ch)
+
+		for v, err := range Iter[T](ctx, db, query, args...) {
+			if err != nil {
+				errc <- err
+				return
+			}
+
+			select {
+			case ch <- v:
+			case <-ctx.Done():
+				errc <- ctx.Err()
+				return
+			}
+		}
+	}()
+
+	return ch, errc
+}
+
+// singleRow is the current row of sql rows, so that scan scans it with the mapping of scan.Rows.
+// Closing it does not close the rows.
+type singleRow struct {
+	*sql.Rows
+	scanned bool
+}
+
+func (r *singleRow) Next() bool {
+	next := !r.scanned
+	r.scanned = true
+	return next
+}
+
+func (r *singleRow) Close() error {
+	return nil
+}
+
 // Row is a helper function that wraps sql rows to scan into a single struct.
 // Row scans structs based on their db tag, and scan any fields not tagged with the db tag matched column name,
 // So had better to tag all fields with db tag to avoid unexpected behavior.
-func Row[T any](ctx context.Context, db *sql.DB, query string, args ...any) (T, error) {
-	var result T
-
-	query = strings.TrimSuffix(strings.TrimSpace(query), ";")
+// A SELECT query without a top-level LIMIT, FETCH, OFFSET or TOP clause is limited to one row with the syntax of
+// SQLite, which MySQL and PostgreSQL share, see RowDialect for other databases.
+// Row returns sql.ErrNoRows if the query returns no row.
+func Row[T any](ctx context.Context, db Querier, query string, args ...any) (T, error) {
+	return RowDialect[T](ctx, db, SQLite, query, args...)
+}
 
-	if !strings.Contains(strings.ToUpper(query), "LIMIT") {
-		query += " LIMIT 1"
-	}
+// RowDialect is a helper function like Row, the query is limited to one row with the syntax of the dialect
+// where the dialect allows it.
+func RowDialect[T any](ctx context.Context, db Querier, d Dialect, query string, args ...any) (T, error) {
+	query = d.limitOne(strings.TrimSuffix(strings.TrimSpace(query), ";"))
 
-	rows, err := db.QueryContext(ctx, query, args...)
-	if err != nil {
+	// the first row, the rows are closed when the loop returns
+	for result, err := range Iter[T](ctx, db, query, args...) {
 		return result, err
 	}
 
-	err = scan.Row(&result, rows)
-
-	return result, err
+	var result T
+	return result, sql.ErrNoRows
 }
 
 // Count is a helper function that wraps sql rows to scan into a single int.
 // The query should return a single column with interger type such as count,sum etc. with a single row.
-func Count(ctx context.Context, db *sql.DB, query string, args ...any) (int64, error) {
+func Count(ctx context.Context, db Querier, query string, args ...any) (int64, error) {
 	// it is a query more simple than Row[int64]
 	var count int64
 
@@ -60,7 +167,7 @@ func Count(ctx context.Context, db *sql.DB, query string, args ...any) (int64, e
 }
 
 // Insert is a helper function that wraps sql exec to insert a row.
-func Insert(ctx context.Context, db *sql.DB, query string, args ...any) (int64, error) {
+func Insert(ctx context.Context, db Querier, query string, args ...any) (int64, error) {
 	result, err := db.ExecContext(ctx, query, args...)
 	if err != nil {
 		return 0, err
@@ -70,28 +177,20 @@ func Insert(ctx context.Context, db *sql.DB, query string, args ...any) (int64,
 }
 
 // InsertTx is a helper function that wraps sql exec to insert a row in a transaction.
-func InsertTx(ctx context.Context, db *sql.DB, query string, args ...any) (int64, error) {
-	tx, err := db.BeginTx(ctx, nil)
-	if err != nil {
-		return 0, err
-	}
-
-	result, err := tx.ExecContext(ctx, query, args...)
-	if err != nil {
-		tx.Rollback()
-		return 0, err
-	}
-
-	err = tx.Commit()
-	if err != nil {
-		return 0, err
-	}
+// It runs in a savepoint if db is a *sql.Tx.
+func InsertTx(ctx context.Context, db Querier, query string, args ...any) (int64, error) {
+	var id int64
+	err := Tx(ctx, db, func(tx *sql.Tx, ctx context.Context) error {
+		var err error
+		id, err = Insert(ctx, tx, query, args...)
+		return err
+	})
 
-	return result.LastInsertId()
+	return id, err
 }
 
 // Delete is a helper function that wraps sql exec to delete rows.
-func Delete(ctx context.Context, db *sql.DB, query string, args ...any) (int64, error) {
+func Delete(ctx context.Context, db Querier, query string, args ...any) (int64, error) {
 	result, err := db.ExecContext(ctx, query, args...)
 	if err != nil {
 		return 0, err
@@ -101,7 +200,7 @@ func Delete(ctx context.Context, db *sql.DB, query string, args ...any) (int64,
 }
 
 // Update is a helper function that wraps sql exec to update rows.
-func Update(ctx context.Context, db *sql.DB, query string, args ...any) (int64, error) {
+func Update(ctx context.Context, db Querier, query string, args ...any) (int64, error) {
 	result, err := db.ExecContext(ctx, query, args...)
 	if err != nil {
 		return 0, err
@@ -111,43 +210,92 @@ func Update(ctx context.Context, db *sql.DB, query string, args ...any) (int64,
 }
 
 // UpdateTx is a helper function that wraps sql exec to update rows in a transaction.
-func UpdateTx(ctx context.Context, db *sql.DB, query string, args ...any) (int64, error) {
-	tx, err := db.BeginTx(ctx, nil)
-	if err != nil {
-		return 0, err
+// It runs in a savepoint if db is a *sql.Tx.
+func UpdateTx(ctx context.Context, db Querier, query string, args ...any) (int64, error) {
+	var affected int64
+	err := Tx(ctx, db, func(tx *sql.Tx, ctx context.Context) error {
+		var err error
+		affected, err = Update(ctx, tx, query, args...)
+		return err
+	})
+
+	return affected, err
+}
+
+// savepoints numbers the savepoints of nested transactions so that their names are unique.
+var savepoints atomic.Uint64
+
+// Tx is a helper function that runs fn in a transaction, fn must run its statements with tx.
+// The transaction is committed if fn returns nil, and rolled back if fn returns an error or panics.
+//
+// db is a *sql.DB or *sql.Conn to begin a transaction, or a *sql.Tx to nest a transaction in a savepoint:
+// a nested transaction rolled back only rolls back its own statements.
+func Tx(ctx context.Context, db Querier, fn func(tx *sql.Tx, ctx context.Context) error) error {
+	return runTx(ctx, db, nil, fn)
+}
+
+// runTx runs fn in a transaction begun with opts, or in a savepoint of db if it is a *sql.Tx.
+func runTx(ctx context.Context, db Querier, opts *sql.TxOptions, fn func(tx *sql.Tx, ctx context.Context) error) error {
+	if tx, ok := db.(*sql.Tx); ok {
+		return savepoint(ctx, tx, fn)
 	}
 
-	result, err := tx.ExecContext(ctx, query, args...)
-	if err != nil {
-		tx.Rollback()
-		return 0, err
+	beginner, ok := db.(TxBeginner)
+	if !ok {
+		return fmt.Errorf("db: %T can not begin a transaction", db)
 	}
 
-	err = tx.Commit()
+	tx, err := beginner.BeginTx(ctx, opts)
 	if err != nil {
-		return 0, err
+		return err
 	}
 
-	return result.RowsAffected()
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(tx, ctx); err != nil {
+		if rerr := tx.Rollback(); rerr != nil && !errors.Is(rerr, sql.ErrTxDone) {
+			return errors.Join(err, rerr)
+		}
+		return err
+	}
+
+	return tx.Commit()
 }
 
-// Tx is a helper function that wraps sql exec to run in a transaction.
-func Tx(ctx context.Context, db *sql.DB, fn func(db *sql.DB, ctx context.Context) error) error {
-	tx, err := db.BeginTx(ctx, nil)
-	if err != nil {
+// savepoint runs fn in a savepoint of tx, the savepoint is rolled back if fn returns an error or panics.
+func savepoint(ctx context.Context, tx *sql.Tx, fn func(tx *sql.Tx, ctx context.Context) error) error {
+	name := fmt.Sprintf("db_savepoint_%d", savepoints.Add(1))
+	if _, err := tx.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
 		return err
 	}
 
-	err = fn(db, ctx)
-	if err != nil {
-		tx.Rollback()
+	rollback := func() error {
+		_, err := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name)
+		if err == nil {
+			_, err = tx.ExecContext(ctx, "RELEASE SAVEPOINT "+name)
+		}
 		return err
 	}
 
-	err = tx.Commit()
-	if err != nil {
+	defer func() {
+		if p := recover(); p != nil {
+			rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(tx, ctx); err != nil {
+		if rerr := rollback(); rerr != nil {
+			return errors.Join(err, rerr)
+		}
 		return err
 	}
 
-	return nil
+	_, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT "+name)
+	return err
 }
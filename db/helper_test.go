@@ -3,9 +3,13 @@ package db
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"testing"
 
+	"github.com/blockloop/scan/v2"
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/smallnest/exp/chanx"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -51,6 +55,68 @@ func TestRows(t *testing.T) {
 	assert.Equal(t, "fred", names[1])
 }
 
+func TestIter(t *testing.T) {
+	db := exampleDB(t)
+	ctx := context.Background()
+
+	var persons []person
+	for p, err := range Iter[person](ctx, db, "SELECT * FROM persons ORDER BY id") {
+		require.NoError(t, err)
+		persons = append(persons, p)
+	}
+	assert.Equal(t, []person{{ID: 1, Name: "brett"}, {ID: 2, Name: "fred"}}, persons)
+
+	// breaking the loop closes the rows
+	for name, err := range Iter[string](ctx, db, "SELECT name FROM persons ORDER BY id") {
+		require.NoError(t, err)
+		assert.Equal(t, "brett", name)
+		break
+	}
+	assert.Equal(t, 0, db.Stats().InUse)
+
+	for _, err := range Iter[string](ctx, db, "SELECT * FROM persons") {
+		assert.ErrorIs(t, err, scan.ErrTooManyColumns)
+	}
+	for _, err := range Iter[string](ctx, db, "SELECT * FROM missing") {
+		assert.Error(t, err)
+	}
+}
+
+func TestIterChan(t *testing.T) {
+	db := exampleDB(t)
+	_, err := db.Exec("INSERT INTO persons (name) VALUES ('grace'), ('heidi'), ('ivan')")
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	ch, errc := IterChan[person](ctx, db, "SELECT * FROM persons ORDER BY id")
+	var sizes []int
+	chanx.Batch(ctx, ch, 2, func(batch []person) {
+		sizes = append(sizes, len(batch))
+	})
+	assert.NoError(t, <-errc)
+	assert.Equal(t, 5, sum(sizes))
+
+	// cancelling ctx stops the producer
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, errc = IterChan[person](ctx, db, "SELECT * FROM persons ORDER BY id")
+	<-ch
+	cancel()
+	assert.ErrorIs(t, <-errc, context.Canceled)
+	_, ok := <-ch
+	assert.False(t, ok)
+
+	_, errc = IterChan[person](context.Background(), db, "SELECT * FROM missing")
+	assert.Error(t, <-errc)
+}
+
+func sum(values []int) int {
+	var n int
+	for _, v := range values {
+		n += v
+	}
+	return n
+}
+
 func TestRow(t *testing.T) {
 	db := exampleDB(t)
 
@@ -66,6 +132,13 @@ func TestRow(t *testing.T) {
 	name, err = Row[string](context.Background(), db, "SELECT name FROM persons order by id")
 	assert.NoError(t, err)
 	assert.Equal(t, "brett", name)
+
+	name, err = Row[string](context.Background(), db, "SELECT name AS limit_name FROM persons order by id desc;")
+	assert.NoError(t, err)
+	assert.Equal(t, "fred", name)
+
+	_, err = Row[string](context.Background(), db, "SELECT name FROM persons WHERE id = ?", 3)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
 }
 
 func TestInsert(t *testing.T) {
@@ -178,3 +251,97 @@ func TestUpdateTx(t *testing.T) {
 	assert.Equal(t, int(id), p.ID)
 	assert.Equal(t, "frank_updated", p.Name)
 }
+
+func TestTx(t *testing.T) {
+	db := exampleDB(t)
+	db.SetMaxOpenConns(1)
+	ctx := context.Background()
+
+	err := Tx(ctx, db, func(tx *sql.Tx, ctx context.Context) error {
+		_, err := Insert(ctx, tx, "INSERT INTO persons (name) VALUES (?)", "grace")
+		return err
+	})
+	require.NoError(t, err)
+
+	errRollback := errors.New("rollback")
+	err = Tx(ctx, db, func(tx *sql.Tx, ctx context.Context) error {
+		if _, err := Insert(ctx, tx, "INSERT INTO persons (name) VALUES (?)", "heidi"); err != nil {
+			return err
+		}
+		return errRollback
+	})
+	assert.ErrorIs(t, err, errRollback)
+
+	assert.Panics(t, func() {
+		Tx(ctx, db, func(tx *sql.Tx, ctx context.Context) error {
+			Insert(ctx, tx, "INSERT INTO persons (name) VALUES (?)", "ivan")
+			panic("boom")
+		})
+	})
+
+	names, err := Rows[string](ctx, db, "SELECT name FROM persons ORDER BY id")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"brett", "fred", "grace"}, names)
+}
+
+func TestTx_Savepoint(t *testing.T) {
+	db := exampleDB(t)
+	db.SetMaxOpenConns(1)
+	ctx := context.Background()
+
+	errRollback := errors.New("rollback")
+	err := Tx(ctx, db, func(tx *sql.Tx, ctx context.Context) error {
+		if _, err := Insert(ctx, tx, "INSERT INTO persons (name) VALUES (?)", "grace"); err != nil {
+			return err
+		}
+
+		// a nested transaction rolled back keeps the statements of the outer transaction
+		err := Tx(ctx, tx, func(tx *sql.Tx, ctx context.Context) error {
+			if _, err := Insert(ctx, tx, "INSERT INTO persons (name) VALUES (?)", "heidi"); err != nil {
+				return err
+			}
+			return errRollback
+		})
+		if !errors.Is(err, errRollback) {
+			return fmt.Errorf("nested transaction: %w", err)
+		}
+
+		_, err = UpdateTx(ctx, tx, "UPDATE persons SET name = ? WHERE name = ?", "grace hopper", "grace")
+		return err
+	})
+	require.NoError(t, err)
+
+	names, err := Rows[string](ctx, db, "SELECT name FROM persons ORDER BY id")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"brett", "fred", "grace hopper"}, names)
+}
+
+func TestRow_NoRows(t *testing.T) {
+	db := exampleDB(t)
+
+	_, err := Row[person](context.Background(), db, "SELECT * FROM persons WHERE id = ?", 3)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	_, err = Row[int64](context.Background(), db, "SELECT id FROM persons WHERE name = ? FOR UPDATE", "brett")
+	assert.Error(t, err, "sqlite does not support FOR UPDATE")
+}
+
+func TestQuerier_Conn(t *testing.T) {
+	db := exampleDB(t)
+	ctx := context.Background()
+
+	conn, err := db.Conn(ctx)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	id, err := InsertTx(ctx, conn, "INSERT INTO persons (name) VALUES (?)", "judy")
+	require.NoError(t, err)
+
+	p, err := Row[person](ctx, conn, "SELECT * FROM persons WHERE id = ?", id)
+	require.NoError(t, err)
+	assert.Equal(t, "judy", p.Name)
+
+	count, err := Count(ctx, conn, "SELECT count(*) FROM persons")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), count)
+}
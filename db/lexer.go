@@ -0,0 +1,151 @@
+package db
+
+import "strings"
+
+// tokenKind is the kind of a SQL token.
+type tokenKind int
+
+const (
+	tokWord   tokenKind = iota // keyword or unquoted identifier
+	tokQuoted                  // string literal or quoted identifier
+	tokPunct                   // operators, punctuation, numbers and placeholders
+)
+
+// token is a SQL token, text is upper-cased for words.
+type token struct {
+	kind  tokenKind
+	text  string
+	start int
+	end   int
+	// depth is the number of parentheses enclosing the token.
+	depth int
+}
+
+// is reports whether the token is the top-level keyword word.
+func (t token) is(word string) bool {
+	return t.kind == tokWord && t.depth == 0 && t.text == word
+}
+
+// lex splits a SQL statement into tokens, comments and whitespace are dropped.
+// Backslashes escape quotes in string literals of MySQL and in E'...' escape strings of PostgreSQL.
+func (d Dialect) lex(sql string) []token {
+	var toks []token
+
+	depth := 0
+	n := len(sql)
+	for i := 0; i < n; {
+		c := sql[i]
+		start, kind, tokDepth := i, tokPunct, depth
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			i++
+			continue
+
+		case c == '-' && i+1 < n && sql[i+1] == '-': // line comment
+			for i < n && sql[i] != '\n' {
+				i++
+			}
+			continue
+
+		case c == '/' && i+1 < n && sql[i+1] == '*': // block comment
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				i = n
+			} else {
+				i += end + 4
+			}
+			continue
+
+		case c == '\'' || c == '"' || c == '`' || c == '[':
+			i = skipQuoted(sql, i, d == MySQL && c == '\'')
+			kind = tokQuoted
+
+		case d == PostgreSQL && (c == 'E' || c == 'e') && i+1 < n && sql[i+1] == '\'': // escape string constant
+			i = skipQuoted(sql, i+1, true)
+			kind = tokQuoted
+
+		case c == '$' && i+1 < n && (sql[i+1] == '$' || isIdentStart(sql[i+1])): // PostgreSQL dollar quoting
+			j := i + 1
+			for j < n && isIdentPart(sql[j]) && sql[j] != '$' {
+				j++
+			}
+			if j >= n || sql[j] != '$' {
+				i = j
+				break
+			}
+			tag := sql[i : j+1]
+			end := strings.Index(sql[j+1:], tag)
+			if end < 0 {
+				i = n
+			} else {
+				i = j + 1 + end + len(tag)
+			}
+			kind = tokQuoted
+
+		case isIdentStart(c):
+			for i < n && isIdentPart(sql[i]) {
+				i++
+			}
+			kind = tokWord
+
+		case c == '(':
+			depth++
+			i++
+
+		case c == ')':
+			depth = max(depth-1, 0)
+			tokDepth = depth
+			i++
+
+		default:
+			i++
+		}
+
+		text := sql[start:i]
+		if kind == tokWord {
+			text = strings.ToUpper(text)
+		}
+		toks = append(toks, token{kind: kind, text: text, start: start, end: i, depth: tokDepth})
+	}
+
+	return toks
+}
+
+// skipQuoted returns the end of the quoted string or identifier starting at i, after its closing quote.
+// Doubled quotes are escaped quotes, and so are quotes following a backslash if backslash is set.
+func skipQuoted(sql string, i int, backslash bool) int {
+	c, n := sql[i], len(sql)
+	closing := c
+	if c == '[' {
+		closing = ']'
+	}
+	i++
+	for i < n {
+		if backslash && sql[i] == '\\' {
+			i += 2
+			continue
+		}
+		if sql[i] == closing {
+			if i+1 < n && sql[i+1] == closing && c != '[' { // escaped quote
+				i += 2
+				continue
+			}
+			break
+		}
+		i++
+	}
+	return min(i+1, n)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || isDigit(c) || c == '$'
+}
@@ -0,0 +1,121 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math/rand/v2"
+	"reflect"
+	"time"
+)
+
+const (
+	// maxTxAttempts is the number of times TxWithRetry runs a transaction.
+	maxTxAttempts = 10
+	// minTxBackoff and maxTxBackoff bound the exponential backoff between the attempts of TxWithRetry.
+	minTxBackoff = 10 * time.Millisecond
+	maxTxBackoff = time.Second
+)
+
+// TxWithRetry is a helper function that runs fn in a transaction begun with opts, see Tx, and runs it again
+// in a new transaction if it fails with a retryable error, see IsRetryable. opts sets the isolation level
+// and read-only mode of the transactions, it may be nil.
+//
+// fn runs up to 10 times, with a jittered exponential backoff between the attempts. Retrying stops when ctx is done,
+// the error of the last attempt is then returned with the error of ctx. fn must not have side effects outside
+// the transaction, as it may run several times.
+//
+// If db is a *sql.Tx, fn runs once in a savepoint: a serialization failure aborts the outer transaction,
+// which must be retried instead.
+func TxWithRetry(ctx context.Context, db Querier, opts *sql.TxOptions, fn func(tx *sql.Tx, ctx context.Context) error) error {
+	if _, ok := db.(*sql.Tx); ok {
+		return runTx(ctx, db, opts, fn)
+	}
+
+	backoff := minTxBackoff
+	for attempt := 1; ; attempt++ {
+		err := runTx(ctx, db, opts, fn)
+		if err == nil || attempt >= maxTxAttempts || !IsRetryable(err) {
+			return err
+		}
+
+		// full jitter spreads the retries of conflicting transactions
+		delay := rand.N(backoff) + 1
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return errors.Join(err, context.DeadlineExceeded)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(err, ctx.Err())
+		case <-timer.C:
+		}
+
+		backoff = min(2*backoff, maxTxBackoff)
+	}
+}
+
+// IsRetryable reports whether err fails a transaction which succeeds if it is run again:
+// a serialization failure or a deadlock, or a locked SQLite database.
+//
+// Drivers are not imported, their errors are classified by:
+//   - the SQLSTATE of PostgreSQL drivers (pgx, lib/pq) returned by their SQLState method: 40001 (serialization_failure)
+//     and 40P01 (deadlock_detected);
+//   - the Number of MySQL errors: 1213 (ER_LOCK_DEADLOCK);
+//   - the Code of SQLite errors: SQLITE_BUSY, as a field of sqlite3.Error (mattn/go-sqlite3) or a method
+//     of *sqlite.Error (modernc.org/sqlite). Other errors with a Code are not SQLite errors.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if v := reflect.ValueOf(err); v.Kind() == reflect.Pointer && v.IsNil() {
+		// a typed nil, its methods may dereference it
+		return false
+	}
+
+	if e, ok := err.(interface{ SQLState() string }); ok {
+		switch e.SQLState() {
+		case "40001", "40P01":
+			return true
+		}
+	}
+
+	v := reflect.Indirect(reflect.ValueOf(err))
+	if !v.IsValid() {
+		return false
+	}
+	switch v.Type().String() {
+	case "sqlite3.Error":
+		if f := v.FieldByName("Code"); f.IsValid() && f.CanInt() && isSQLiteBusy(f.Int()) {
+			return true
+		}
+	case "sqlite.Error":
+		if e, ok := err.(interface{ Code() int }); ok && isSQLiteBusy(int64(e.Code())) {
+			return true
+		}
+	}
+	if v.Kind() == reflect.Struct {
+		if f := v.FieldByName("Number"); f.IsValid() && f.CanUint() && f.Uint() == 1213 {
+			return true
+		}
+	}
+
+	switch e := err.(type) {
+	case interface{ Unwrap() error }:
+		return IsRetryable(e.Unwrap())
+	case interface{ Unwrap() []error }:
+		for _, err := range e.Unwrap() {
+			if IsRetryable(err) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isSQLiteBusy reports whether the primary result code of an SQLite error, its low byte, is SQLITE_BUSY.
+func isSQLiteBusy(code int64) bool {
+	return code&0xff == 5
+}
@@ -0,0 +1,154 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type pgError struct {
+	code string
+}
+
+func (e *pgError) Error() string    { return "pg: " + e.code }
+func (e *pgError) SQLState() string { return e.code }
+
+type mysqlError struct {
+	Number  uint16
+	Message string
+}
+
+func (e *mysqlError) Error() string { return fmt.Sprintf("Error %d: %s", e.Number, e.Message) }
+
+// codeError has a Code as SQLite errors, but it is not one.
+type codeError struct {
+	Code int
+}
+
+func (e codeError) Error() string { return fmt.Sprintf("code %d", e.Code) }
+
+// codeMethodError has a Code method as modernc.org/sqlite errors, but it is not one.
+type codeMethodError struct{}
+
+func (e *codeMethodError) Error() string { return "code 5" }
+func (e *codeMethodError) Code() int     { return 5 }
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errors.New("boom"), false},
+		{&pgError{code: "40001"}, true},
+		{&pgError{code: "40P01"}, true},
+		{&pgError{code: "23505"}, false},
+		{&mysqlError{Number: 1213, Message: "Deadlock found when trying to get lock"}, true},
+		{&mysqlError{Number: 1062, Message: "Duplicate entry"}, false},
+		{fmt.Errorf("commit: %w", &pgError{code: "40001"}), true},
+		{errors.Join(errors.New("rollback"), &mysqlError{Number: 1213}), true},
+		{sqlite3.Error{Code: sqlite3.ErrBusy, ExtendedCode: sqlite3.ErrBusySnapshot}, true},
+		{sqlite3.Error{Code: sqlite3.ErrConstraint}, false},
+		{fmt.Errorf("begin: %w", sqlite3.Error{Code: sqlite3.ErrBusy}), true},
+		{codeError{Code: 5}, false},
+		{&codeMethodError{}, false},
+		{(*mysqlError)(nil), false},
+		{(*pgError)(nil), false},
+		{fmt.Errorf("commit: %w", (*mysqlError)(nil)), false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, IsRetryable(tt.err), "%v", tt.err)
+	}
+}
+
+func TestTxWithRetry(t *testing.T) {
+	db := exampleDB(t)
+	db.SetMaxOpenConns(1)
+	ctx := context.Background()
+
+	var attempts int
+	err := TxWithRetry(ctx, db, nil, func(tx *sql.Tx, ctx context.Context) error {
+		attempts++
+		if _, err := Insert(ctx, tx, "INSERT INTO persons (name) VALUES (?)", fmt.Sprintf("attempt %d", attempts)); err != nil {
+			return err
+		}
+		if attempts < 3 {
+			return &pgError{code: "40001"}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+
+	names, err := Rows[string](ctx, db, "SELECT name FROM persons ORDER BY id")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"brett", "fred", "attempt 3"}, names, "failed attempts are rolled back")
+
+	// other errors are not retried
+	attempts = 0
+	errBoom := errors.New("boom")
+	err = TxWithRetry(ctx, db, nil, func(tx *sql.Tx, ctx context.Context) error {
+		attempts++
+		return errBoom
+	})
+	assert.ErrorIs(t, err, errBoom)
+	assert.Equal(t, 1, attempts)
+
+	// retries stop at the deadline of ctx
+	ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	errConflict := &pgError{code: "40P01"}
+	err = TxWithRetry(ctx, db, &sql.TxOptions{Isolation: sql.LevelSerializable}, func(tx *sql.Tx, ctx context.Context) error {
+		return errConflict
+	})
+	assert.ErrorIs(t, err, errConflict)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestTxWithRetry_SQLiteBusy(t *testing.T) {
+	dsn := "file:" + filepath.Join(t.TempDir(), "busy.db") + "?_txlock=immediate&_busy_timeout=0"
+	db, err := sql.Open("sqlite3", dsn)
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec("CREATE TABLE counters (n INTEGER NOT NULL)")
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// a transaction holds the write lock of the database
+	locked, err := db.BeginTx(ctx, nil)
+	require.NoError(t, err)
+	_, err = locked.Exec("INSERT INTO counters (n) VALUES (1)")
+	require.NoError(t, err)
+
+	err = Tx(ctx, db, func(tx *sql.Tx, ctx context.Context) error { return nil })
+	assert.True(t, IsRetryable(err), "%v is retryable", err)
+
+	var attempts atomic.Int32
+	done := make(chan error)
+	go func() {
+		done <- TxWithRetry(ctx, db, nil, func(tx *sql.Tx, ctx context.Context) error {
+			attempts.Add(1)
+			_, err := tx.ExecContext(ctx, "INSERT INTO counters (n) VALUES (2)")
+			return err
+		})
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	require.NoError(t, locked.Commit())
+	require.NoError(t, <-done)
+	assert.Equal(t, int32(1), attempts.Load(), "fn runs once the transaction begins")
+
+	count, err := Count(ctx, db, "SELECT count(*) FROM counters")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+}
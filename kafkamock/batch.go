@@ -0,0 +1,290 @@
+package kafkamock
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// batcher batches the messages of a MockWriter by partition as kafka.Writer does.
+type batcher struct {
+	broker     *Broker
+	size       int
+	bytes      int64
+	timeout    time.Duration
+	async      bool
+	acks       kafka.RequiredAcks
+	completion func(messages []kafka.Message, err error)
+
+	mu      sync.Mutex
+	current map[topicPartition]*writeBatch
+	// queues are the batches to write by partition, unbounded so that enqueueing never blocks
+	// while holding mu. queued is signaled when a batch is queued or the batcher is closed.
+	queues map[topicPartition][]*writeBatch
+	queued *sync.Cond
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// writeBatch is a batch of messages to a partition, it is written when full or when its timeout expires.
+type writeBatch struct {
+	tp    topicPartition
+	msgs  []kafka.Message
+	bytes int64
+	timer *time.Timer
+	done  chan struct{}
+	err   error
+}
+
+// NewBatchedMockWriter creates a new MockWriter writing to broker in batches like kafka.Writer.
+// In addition to the Topic and Balancer, the BatchSize, BatchBytes, BatchTimeout, Async, Completion
+// and RequiredAcks of config are honoured, with the defaults of kafka.Writer:
+//
+//   - messages are batched by partition, a batch is written when it holds BatchSize messages or
+//     BatchBytes bytes, or BatchTimeout after its first message;
+//   - WriteMessages waits for the batches of its messages and returns kafka.WriteErrors if any failed,
+//     unless Async is set;
+//   - Completion is called with the messages of each batch and the error of the write;
+//   - with kafka.RequireNone errors are not reported, and kafka.NotEnoughReplicas only fails writes
+//     with kafka.RequireAll.
+//
+// Failed batches are not retried. Close writes the pending batches and waits for their completion.
+func NewBatchedMockWriter(broker *Broker, config *kafka.Writer) *MockWriter {
+	if config == nil {
+		config = &kafka.Writer{}
+	}
+
+	m := NewBrokerWriter(broker, config)
+	m.batcher = &batcher{
+		broker:     broker,
+		size:       config.BatchSize,
+		bytes:      config.BatchBytes,
+		timeout:    config.BatchTimeout,
+		async:      config.Async,
+		acks:       config.RequiredAcks,
+		completion: config.Completion,
+		current:    make(map[topicPartition]*writeBatch),
+		queues:     make(map[topicPartition][]*writeBatch),
+	}
+	m.batcher.queued = sync.NewCond(&m.batcher.mu)
+	if m.batcher.size <= 0 {
+		m.batcher.size = 100
+	}
+	if m.batcher.bytes <= 0 {
+		m.batcher.bytes = 1048576
+	}
+	if m.batcher.timeout <= 0 {
+		m.batcher.timeout = time.Second
+	}
+	return m
+}
+
+// writeBatched adds messages to the batches of their partitions and waits for the batches to be written.
+func (m *MockWriter) writeBatched(ctx context.Context, msgs []kafka.Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	for i, msg := range msgs {
+		if messageSize(msg) > m.batcher.bytes {
+			remaining := append(append([]kafka.Message{}, msgs[:i]...), msgs[i+1:]...)
+			return kafka.MessageTooLargeError{Message: msg, Remaining: remaining}
+		}
+	}
+
+	tps, err := m.broker.routeAll(m.topic, m.balancer, msgs)
+	if err != nil {
+		return err
+	}
+
+	batches, err := m.batcher.add(msgs, tps)
+	if err != nil || m.batcher.async {
+		return err
+	}
+
+	failed := false
+	for batch := range batches {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-batch.done:
+			failed = failed || batch.err != nil
+		}
+	}
+	if !failed {
+		return nil
+	}
+
+	errs := make(kafka.WriteErrors, len(msgs))
+	for batch, indexes := range batches {
+		for _, i := range indexes {
+			errs[i] = batch.err
+		}
+	}
+	return errs
+}
+
+// add adds messages to the current batches of their partitions, it returns the batches of the messages
+// with the indexes of their messages.
+func (b *batcher) add(msgs []kafka.Message, tps []topicPartition) (map[*writeBatch][]int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, errors.New("writer is closed")
+	}
+
+	batches := make(map[*writeBatch][]int)
+	for i, msg := range msgs {
+		tp := tps[i]
+		size := messageSize(msg)
+
+		batch := b.current[tp]
+		if batch != nil && batch.bytes+size > b.bytes {
+			b.enqueue(batch)
+			batch = nil
+		}
+		if batch == nil {
+			batch = b.newBatch(tp)
+		}
+
+		batch.msgs = append(batch.msgs, msg)
+		batch.bytes += size
+		batches[batch] = append(batches[batch], i)
+
+		if len(batch.msgs) >= b.size || batch.bytes >= b.bytes {
+			b.enqueue(batch)
+		}
+	}
+	return batches, nil
+}
+
+// newBatch starts a batch of a partition, written when its timeout expires. The caller must hold b.mu.
+func (b *batcher) newBatch(tp topicPartition) *writeBatch {
+	batch := &writeBatch{tp: tp, done: make(chan struct{})}
+	batch.timer = time.AfterFunc(b.timeout, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if !b.closed && b.current[tp] == batch {
+			b.enqueue(batch)
+		}
+	})
+	b.current[tp] = batch
+	return batch
+}
+
+// enqueue queues a batch for writing, batches of a partition are written in order by a goroutine.
+// The caller must hold b.mu.
+func (b *batcher) enqueue(batch *writeBatch) {
+	batch.timer.Stop()
+	delete(b.current, batch.tp)
+
+	queue, ok := b.queues[batch.tp]
+	if !ok {
+		b.wg.Add(1)
+		go b.drain(batch.tp)
+	}
+	b.queues[batch.tp] = append(queue, batch)
+	b.queued.Broadcast()
+}
+
+// drain writes the batches queued for a partition until the batcher is closed and the queue is empty.
+func (b *batcher) drain(tp topicPartition) {
+	defer b.wg.Done()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for {
+		queue := b.queues[tp]
+		if len(queue) == 0 {
+			if b.closed {
+				return
+			}
+			b.queued.Wait()
+			continue
+		}
+		b.queues[tp] = queue[1:]
+
+		b.mu.Unlock()
+		b.write(queue[0])
+		b.mu.Lock()
+	}
+}
+
+// write writes a batch to the broker, faults of the broker are injected, then completes the batch.
+func (b *batcher) write(batch *writeBatch) {
+	f := b.broker.writeFault(len(batch.msgs))
+	sleep(context.Background(), nil, f.latency)
+
+	err := b.acked(f.err)
+	if err == nil {
+		var kept []kafka.Message
+		for i, msg := range batch.msgs {
+			if !f.skip(i) {
+				kept = append(kept, msg)
+			}
+		}
+
+		var written []kafka.Message
+		written, err = b.broker.appendBatch(batch.tp, kept)
+		if err == nil {
+			err = f.ackErr
+		}
+		for _, werr := range f.errs {
+			if err == nil {
+				err = b.acked(werr)
+			}
+		}
+
+		// the messages of the batch carry their topic, partition, offset and time as with kafka.Writer
+		for i, j := 0, 0; i < len(batch.msgs) && j < len(written); i++ {
+			if !f.skip(i) {
+				msg := &batch.msgs[i]
+				msg.Topic, msg.Partition, msg.Offset, msg.Time = written[j].Topic, written[j].Partition, written[j].Offset, written[j].Time
+				j++
+			}
+		}
+	}
+	if b.acks == kafka.RequireNone {
+		// fire and forget, the writer does not see the response of the broker
+		err = nil
+	}
+
+	if b.completion != nil {
+		b.completion(batch.msgs, err)
+	}
+
+	batch.err = err
+	close(batch.done)
+}
+
+// acked returns the error of a write seen with the required acks of the writer:
+// the minimum number of in-sync replicas is only enforced with kafka.RequireAll.
+func (b *batcher) acked(err error) error {
+	if b.acks != kafka.RequireAll && (errors.Is(err, kafka.NotEnoughReplicas) || errors.Is(err, kafka.NotEnoughReplicasAfterAppend)) {
+		return nil
+	}
+	return err
+}
+
+// close writes the pending batches and waits for them.
+func (b *batcher) close() {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	for _, batch := range b.current {
+		b.enqueue(batch)
+	}
+	b.closed = true
+	b.queued.Broadcast()
+	b.mu.Unlock()
+
+	b.wg.Wait()
+}
@@ -0,0 +1,193 @@
+package kafkamock
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// completions records the calls of a Completion function.
+type completions struct {
+	mu      sync.Mutex
+	batches [][]kafka.Message
+	errs    []error
+}
+
+func (c *completions) complete(msgs []kafka.Message, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.batches = append(c.batches, msgs)
+	c.errs = append(c.errs, err)
+}
+
+func (c *completions) sizes() []int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var sizes []int
+	for _, batch := range c.batches {
+		sizes = append(sizes, len(batch))
+	}
+	return sizes
+}
+
+func TestBatchedMockWriter_BatchSize(t *testing.T) {
+	broker := NewBroker(1)
+	var c completions
+	writer := NewBatchedMockWriter(broker, &kafka.Writer{
+		Topic:        "orders",
+		BatchSize:    3,
+		BatchTimeout: time.Hour,
+		RequiredAcks: kafka.RequireAll,
+		Completion:   c.complete,
+	})
+	defer writer.Close()
+
+	require.NoError(t, writer.WriteMessages(context.Background(),
+		kafka.Message{Value: []byte("o1")},
+		kafka.Message{Value: []byte("o2")},
+		kafka.Message{Value: []byte("o3")},
+	))
+	assert.Len(t, broker.Messages("orders", 0), 3)
+
+	require.Equal(t, []int{3}, c.sizes())
+	assert.NoError(t, c.errs[0])
+	assert.Equal(t, "orders", c.batches[0][2].Topic)
+	assert.Equal(t, int64(2), c.batches[0][2].Offset)
+}
+
+func TestBatchedMockWriter_BatchTimeout(t *testing.T) {
+	broker := NewBroker(1)
+	writer := NewBatchedMockWriter(broker, &kafka.Writer{BatchTimeout: 20 * time.Millisecond})
+
+	start := time.Now()
+	require.NoError(t, writer.WriteMessages(context.Background(), kafka.Message{Value: []byte("m1")}))
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, writer.WriteMessages(ctx, kafka.Message{Value: []byte("m2")}), context.DeadlineExceeded)
+
+	// Close writes the pending batch
+	require.NoError(t, writer.Close())
+	assert.Len(t, broker.Messages(DefaultTopic, 0), 2)
+	assert.Error(t, writer.WriteMessages(context.Background(), kafka.Message{Value: []byte("m3")}))
+}
+
+func TestBatchedMockWriter_BatchBytes(t *testing.T) {
+	broker := NewBroker(1)
+	var c completions
+	writer := NewBatchedMockWriter(broker, &kafka.Writer{
+		BatchBytes:   10,
+		BatchTimeout: time.Millisecond,
+		Completion:   c.complete,
+	})
+	defer writer.Close()
+
+	require.NoError(t, writer.WriteMessages(context.Background(),
+		kafka.Message{Value: []byte("aaaa")},
+		kafka.Message{Value: []byte("bbbb")},
+		kafka.Message{Value: []byte("cccc")},
+	))
+	assert.Equal(t, []int{2, 1}, c.sizes())
+
+	large := kafka.Message{Value: []byte("0123456789a")}
+	err := writer.WriteMessages(context.Background(), kafka.Message{Value: []byte("m")}, large)
+
+	var tooLarge kafka.MessageTooLargeError
+	require.ErrorAs(t, err, &tooLarge)
+	assert.Equal(t, large, tooLarge.Message)
+	assert.Len(t, tooLarge.Remaining, 1)
+}
+
+func TestBatchedMockWriter_Async(t *testing.T) {
+	broker := NewBroker(1)
+	var c completions
+	writer := NewBatchedMockWriter(broker, &kafka.Writer{
+		BatchTimeout: time.Hour,
+		Async:        true,
+		RequiredAcks: kafka.RequireOne,
+		Completion:   c.complete,
+	})
+
+	broker.FailWrites(1, kafka.LeaderNotAvailable)
+	require.NoError(t, writer.WriteMessages(context.Background(), kafka.Message{Value: []byte("lost")}))
+	assert.Empty(t, c.sizes(), "the write is pending")
+
+	// Close writes the pending batch and waits for the completion
+	require.NoError(t, writer.Close())
+	require.Equal(t, []int{1}, c.sizes())
+	assert.ErrorIs(t, c.errs[0], kafka.LeaderNotAvailable)
+	assert.Empty(t, broker.Messages(DefaultTopic, 0))
+}
+
+func TestBatchedMockWriter_RequiredAcks(t *testing.T) {
+	write := func(acks kafka.RequiredAcks, fault error) (int, error) {
+		broker := NewBroker(1)
+		writer := NewBatchedMockWriter(broker, &kafka.Writer{BatchTimeout: time.Millisecond, RequiredAcks: acks})
+		defer writer.Close()
+
+		broker.FailWrites(1, fault)
+		err := writer.WriteMessages(context.Background(), kafka.Message{Value: []byte("m")})
+		return len(broker.Messages(DefaultTopic, 0)), err
+	}
+
+	// fire and forget does not see errors
+	n, err := write(kafka.RequireNone, kafka.LeaderNotAvailable)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	n, err = write(kafka.RequireOne, kafka.LeaderNotAvailable)
+	var errs kafka.WriteErrors
+	require.ErrorAs(t, err, &errs)
+	assert.ErrorIs(t, errs[0], kafka.LeaderNotAvailable)
+	assert.Equal(t, 0, n)
+
+	// the leader acknowledges the write without enough in-sync replicas
+	n, err = write(kafka.RequireOne, kafka.NotEnoughReplicas)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	n, err = write(kafka.RequireAll, kafka.NotEnoughReplicas)
+	require.ErrorAs(t, err, &errs)
+	assert.ErrorIs(t, errs[0], kafka.NotEnoughReplicas)
+	assert.Equal(t, 0, n)
+}
+
+func TestBatchedMockWriter_QueueDoesNotBlock(t *testing.T) {
+	broker := NewBroker(1)
+	release := make(chan struct{})
+	var once sync.Once
+	writer := NewBatchedMockWriter(broker, &kafka.Writer{
+		Topic:     "orders",
+		BatchSize: 1,
+		Async:     true,
+		// the first batch blocks the writes of the partition
+		Completion: func([]kafka.Message, error) { once.Do(func() { <-release }) },
+	})
+
+	msgs := make([]kafka.Message, 40)
+	for i := range msgs {
+		msgs[i] = kafka.Message{Value: []byte("order")}
+	}
+
+	done := make(chan error)
+	go func() { done <- writer.WriteMessages(context.Background(), msgs...) }()
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("WriteMessages blocked while the batches of the partition are written")
+	}
+
+	close(release)
+	require.NoError(t, writer.Close())
+	assert.Len(t, broker.Messages("orders", 0), 40)
+}
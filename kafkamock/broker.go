@@ -0,0 +1,332 @@
+package kafkamock
+
+import (
+	"errors"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// DefaultTopic is the topic of messages written without a topic on neither the writer nor the message.
+const DefaultTopic = "default"
+
+// Broker is an in-memory kafka broker holding named topics and their partitions.
+// Topics are created on the first write with the default partition count unless created by CreateTopic.
+type Broker struct {
+	mu         sync.Mutex
+	partitions int
+	topics     map[string]*topic
+	groups     map[string]*group
+
+	// producers are the idempotent producers by producer id, transactional producers are also
+	// indexed by transactional id.
+	producers      map[int64]*producerState
+	transactional  map[string]int64
+	nextProducerID int64
+
+	// changed is closed and replaced when messages are written or group members change,
+	// waking up blocked readers.
+	changed chan struct{}
+
+	faults faults
+
+	// tap receives every message written, it is used by MockKafka.GetMessages.
+	tap func(kafka.Message)
+}
+
+type topic struct {
+	name       string
+	partitions []*partition
+	retention  RetentionPolicy
+}
+
+// partition is the log of a partition, offsets increase monotonically starting from 0.
+// Messages deleted by the retention policy leave gaps in the offsets.
+type partition struct {
+	messages []kafka.Message
+	// startOffset is the first offset retained, it is moved by deleting messages but not by compaction
+	startOffset int64
+	nextOffset  int64
+
+	// open are the first offsets of the open transactions by producer id,
+	// read_committed readers do not read past the first of them.
+	open map[int64]int64
+	// aborted are the offsets of messages of aborted transactions, skipped by read_committed readers.
+	aborted map[int64]struct{}
+}
+
+// NewBroker creates a new Broker, topics are created with the given number of partitions by default.
+func NewBroker(partitions int) *Broker {
+	return &Broker{
+		partitions: max(partitions, 1),
+		topics:     make(map[string]*topic),
+		groups:     make(map[string]*group),
+		changed:    make(chan struct{}),
+		faults:     newFaults(1),
+
+		producers:     make(map[int64]*producerState),
+		transactional: make(map[string]int64),
+	}
+}
+
+// CreateTopic creates a topic with the number of partitions.
+func (b *Broker) CreateTopic(name string, partitions int) error {
+	if name == "" {
+		return kafka.InvalidTopic
+	}
+	if partitions < 1 {
+		return kafka.InvalidPartitionNumber
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.topics[name]; ok {
+		return kafka.TopicAlreadyExists
+	}
+	b.createTopic(name, partitions)
+	return nil
+}
+
+// createTopic creates a topic, the caller must hold b.mu.
+func (b *Broker) createTopic(name string, partitions int) *topic {
+	t := &topic{name: name, partitions: make([]*partition, partitions)}
+	for i := range t.partitions {
+		t.partitions[i] = &partition{open: make(map[int64]int64), aborted: make(map[int64]struct{})}
+	}
+	b.topics[name] = t
+	return t
+}
+
+// Topics returns the names of all topics, sorted.
+func (b *Broker) Topics() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	names := make([]string, 0, len(b.topics))
+	for name := range b.topics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Partitions returns the number of partitions of the topic, 0 if the topic does not exist.
+func (b *Broker) Partitions(topic string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if t, ok := b.topics[topic]; ok {
+		return len(t.partitions)
+	}
+	return 0
+}
+
+// Messages returns the messages in the log of a partition of the topic.
+func (b *Broker) Messages(topic string, partition int) []kafka.Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	p, err := b.partition(topic, partition)
+	if err != nil || p == nil {
+		return nil
+	}
+	return slices.Clone(p.messages)
+}
+
+// partition returns a partition of the topic, nil if the topic does not exist yet.
+// The caller must hold b.mu.
+func (b *Broker) partition(topic string, partition int) (*partition, error) {
+	t, ok := b.topics[topic]
+	if !ok {
+		return nil, nil
+	}
+	if partition < 0 || partition >= len(t.partitions) {
+		return nil, kafka.UnknownTopicOrPartition
+	}
+	return t.partitions[partition], nil
+}
+
+// produce appends messages to their topics, partitioned by balancer.
+// The topic of a message is the writer topic or the message topic, DefaultTopic if neither is set.
+// It returns the messages with their topic, partition, offset and time assigned.
+func (b *Broker) produce(writerTopic string, balancer kafka.Balancer, msgs []kafka.Message) ([]kafka.Message, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, msg := range msgs {
+		if writerTopic != "" && msg.Topic != "" {
+			return nil, errors.New("topic must not be specified for both writer and message")
+		}
+	}
+
+	written := make([]kafka.Message, len(msgs))
+	now := time.Now()
+	for i, msg := range msgs {
+		t, partition := b.route(writerTopic, balancer, msg)
+		written[i] = b.append(t, partition, msg, now)
+	}
+
+	b.notify()
+	return written, nil
+}
+
+// route returns the topic and partition of a message, creating the topic on first use.
+// The caller must hold b.mu.
+func (b *Broker) route(writerTopic string, balancer kafka.Balancer, msg kafka.Message) (*topic, int) {
+	name := writerTopic
+	if name == "" {
+		name = msg.Topic
+	}
+	if name == "" {
+		name = DefaultTopic
+	}
+
+	t, ok := b.topics[name]
+	if !ok {
+		t = b.createTopic(name, b.partitions)
+	}
+
+	partitions := make([]int, len(t.partitions))
+	for i := range partitions {
+		partitions[i] = i
+	}
+	return t, balancer.Balance(msg, partitions...)
+}
+
+// appendBatch appends messages to a partition and returns them with their topic, partition, offset and time assigned.
+func (b *Broker) appendBatch(tp topicPartition, msgs []kafka.Message) ([]kafka.Message, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t, ok := b.topics[tp.topic]
+	if !ok || tp.partition < 0 || tp.partition >= len(t.partitions) {
+		return nil, kafka.UnknownTopicOrPartition
+	}
+
+	written := make([]kafka.Message, len(msgs))
+	now := time.Now()
+	for i, msg := range msgs {
+		written[i] = b.append(t, tp.partition, msg, now)
+	}
+
+	b.notify()
+	return written, nil
+}
+
+// append appends a message to a partition of the topic and returns it with its topic, partition,
+// offset and time assigned. The caller must hold b.mu and call b.notify once done.
+func (b *Broker) append(t *topic, partition int, msg kafka.Message, now time.Time) kafka.Message {
+	msg = cloneMessage(msg)
+	msg.Topic = t.name
+	msg.Partition = partition
+	if msg.Time.IsZero() {
+		msg.Time = now
+	}
+
+	p := t.partitions[partition]
+	msg.Offset = p.nextOffset
+	p.nextOffset++
+	p.messages = append(p.messages, msg)
+
+	if b.tap != nil {
+		b.tap(msg)
+	}
+	return msg
+}
+
+// wait returns a channel closed on the next change of the broker.
+func (b *Broker) wait() <-chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.changed
+}
+
+// notify wakes up blocked readers, the caller must hold b.mu.
+func (b *Broker) notify() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// offsets returns the first offset retained and the offset after the last message of a partition.
+func (b *Broker) offsets(topic string, partition int) (first, next int64, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	p, err := b.partition(topic, partition)
+	if err != nil || p == nil {
+		return 0, 0, err
+	}
+	return p.startOffset, p.nextOffset, nil
+}
+
+// offsetAt returns the offset of the first message of a partition written at or after t,
+// the offset after the last message if there is none.
+func (b *Broker) offsetAt(topic string, partition int, t time.Time) (int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	p, err := b.partition(topic, partition)
+	if err != nil || p == nil {
+		return 0, err
+	}
+	for _, msg := range p.messages {
+		if !msg.Time.Before(t) {
+			return msg.Offset, nil
+		}
+	}
+	return p.nextOffset, nil
+}
+
+// wake wakes up blocked readers.
+func (b *Broker) wake() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.notify()
+}
+
+// fetch returns the first message at or after offset in a partition of the topic visible with the
+// isolation level, false if there is no such message.
+func (b *Broker) fetch(topic string, partition int, offset int64, isolation kafka.IsolationLevel) (kafka.Message, bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	p, err := b.partition(topic, partition)
+	if err != nil || p == nil {
+		return kafka.Message{}, false, err
+	}
+
+	i := sort.Search(len(p.messages), func(i int) bool {
+		return p.messages[i].Offset >= offset
+	})
+	for ; i < len(p.messages); i++ {
+		msg := p.messages[i]
+		if isolation == kafka.ReadCommitted {
+			if msg.Offset >= p.lastStable() {
+				break
+			}
+			if _, ok := p.aborted[msg.Offset]; ok {
+				continue
+			}
+		}
+
+		msg.HighWaterMark = p.nextOffset
+		return msg, true, nil
+	}
+
+	return kafka.Message{}, false, nil
+}
+
+// lastStable returns the first offset of the open transactions, the offset after the last message if there is none.
+func (p *partition) lastStable() int64 {
+	offset := p.nextOffset
+	for _, first := range p.open {
+		offset = min(offset, first)
+	}
+	return offset
+}
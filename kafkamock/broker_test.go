@@ -0,0 +1,96 @@
+package kafkamock
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBroker_Partitioning(t *testing.T) {
+	broker := NewBroker(1)
+	require.NoError(t, broker.CreateTopic("orders", 3))
+
+	writer := NewBrokerWriter(broker, &kafka.Writer{Topic: "orders"})
+
+	var msgs []kafka.Message
+	for i := 0; i < 30; i++ {
+		msgs = append(msgs, kafka.Message{
+			Key:   []byte(fmt.Sprintf("user-%d", i%5)),
+			Value: []byte(fmt.Sprintf("order-%d", i)),
+		})
+	}
+	require.NoError(t, writer.WriteMessages(context.Background(), msgs...))
+
+	hash := &kafka.Hash{}
+	total := 0
+	for p := 0; p < 3; p++ {
+		log := broker.Messages("orders", p)
+		total += len(log)
+
+		for i, msg := range log {
+			assert.Equal(t, "orders", msg.Topic)
+			assert.Equal(t, p, msg.Partition)
+			assert.Equal(t, int64(i), msg.Offset, "offsets increase monotonically per partition")
+			assert.False(t, msg.Time.IsZero(), "time is assigned on write")
+			assert.Equal(t, hash.Balance(msg, 0, 1, 2), p, "partition matches kafka.Hash")
+		}
+	}
+	assert.Equal(t, 30, total)
+}
+
+func TestBroker_Topics(t *testing.T) {
+	broker := NewBroker(2)
+
+	writer := NewBrokerWriter(broker, nil)
+	err := writer.WriteMessages(context.Background(),
+		kafka.Message{Topic: "payments", Value: []byte("p1")},
+		kafka.Message{Value: []byte("d1")},
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{DefaultTopic, "payments"}, broker.Topics())
+	assert.Equal(t, 2, broker.Partitions("payments"), "topics are created with the default partition count")
+	assert.Equal(t, 0, broker.Partitions("missing"))
+
+	assert.ErrorIs(t, broker.CreateTopic("payments", 1), kafka.TopicAlreadyExists)
+	assert.ErrorIs(t, broker.CreateTopic("refunds", 0), kafka.InvalidPartitionNumber)
+
+	writer = NewBrokerWriter(broker, &kafka.Writer{Topic: "payments"})
+	err = writer.WriteMessages(context.Background(), kafka.Message{Topic: "refunds"})
+	assert.Error(t, err, "topic must not be set on both writer and message")
+}
+
+func TestMockReader_Partition(t *testing.T) {
+	broker := NewBroker(1)
+	require.NoError(t, broker.CreateTopic("events", 2))
+
+	writer := NewBrokerWriter(broker, &kafka.Writer{Topic: "events", Balancer: &kafka.RoundRobin{}})
+	require.NoError(t, writer.WriteMessages(context.Background(),
+		kafka.Message{Value: []byte("e0")},
+		kafka.Message{Value: []byte("e1")},
+		kafka.Message{Value: []byte("e2")},
+	))
+
+	reader := NewBrokerReader(broker, kafka.ReaderConfig{Topic: "events", Partition: 1})
+
+	msg, err := reader.ReadMessage(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []byte("e1"), msg.Value)
+	assert.Equal(t, 1, msg.Partition)
+	assert.Equal(t, int64(0), msg.Offset)
+	assert.Equal(t, int64(1), msg.HighWaterMark)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = reader.ReadMessage(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	reader = NewBrokerReader(broker, kafka.ReaderConfig{Topic: "events", Partition: 2})
+	_, err = reader.ReadMessage(context.Background())
+	assert.ErrorIs(t, err, kafka.UnknownTopicOrPartition)
+}
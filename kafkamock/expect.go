@@ -0,0 +1,316 @@
+package kafkamock
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/segmentio/kafka-go"
+)
+
+// expectations are the messages a MockKafka expects to be written.
+type expectations struct {
+	mu       sync.Mutex
+	expected []*ExpectedMessage
+	noMore   bool
+}
+
+// ExpectedMessage is a message expected to be written to a topic.
+// Expected messages of a topic are matched in order against the messages written to the topic.
+type ExpectedMessage struct {
+	topic string
+
+	key      []byte
+	hasKey   bool
+	value    []byte
+	hasValue bool
+	headers  []kafka.Header
+
+	jsonValue any
+	hasJSON   bool
+	jsonErr   error
+}
+
+// ExpectMessage expects a message to be written to the topic, DefaultTopic if topic is empty.
+func (m *MockKafka) ExpectMessage(topic string) *ExpectedMessage {
+	if topic == "" {
+		topic = DefaultTopic
+	}
+
+	m.expect.mu.Lock()
+	defer m.expect.mu.Unlock()
+
+	em := &ExpectedMessage{topic: topic}
+	m.expect.expected = append(m.expect.expected, em)
+	return em
+}
+
+// ExpectNoMoreMessages expects no message to be written other than the expected messages.
+func (m *MockKafka) ExpectNoMoreMessages() {
+	m.expect.mu.Lock()
+	defer m.expect.mu.Unlock()
+
+	m.expect.noMore = true
+}
+
+// ExpectationsWereMet checks the messages written to the MockKafka against the expected messages.
+// It reports every missing or mismatching message, and unexpected messages if ExpectNoMoreMessages was called.
+func (m *MockKafka) ExpectationsWereMet() error {
+	written := m.Written()
+
+	m.expect.mu.Lock()
+	defer m.expect.mu.Unlock()
+
+	byTopic := make(map[string][]kafka.Message)
+	for _, msg := range written {
+		byTopic[msg.Topic] = append(byTopic[msg.Topic], msg)
+	}
+
+	var errs *multierror.Error
+	matched := make(map[string]int)
+	for _, em := range m.expect.expected {
+		i := matched[em.topic]
+		matched[em.topic]++
+
+		msgs := byTopic[em.topic]
+		if i >= len(msgs) {
+			errs = multierror.Append(errs, fmt.Errorf("%s: message %d was not written", em, i))
+			continue
+		}
+		if diff := em.diff(msgs[i]); diff != "" {
+			errs = multierror.Append(errs, fmt.Errorf("%s: message %d does not match:%s", em, i, diff))
+		}
+	}
+
+	if m.expect.noMore {
+		topics := make([]string, 0, len(byTopic))
+		for topic := range byTopic {
+			topics = append(topics, topic)
+		}
+		sort.Strings(topics)
+
+		for _, topic := range topics {
+			msgs := byTopic[topic]
+			for i := matched[topic]; i < len(msgs); i++ {
+				errs = multierror.Append(errs, fmt.Errorf("unexpected message %d on topic %q: %s", i, topic, describeMessage(msgs[i])))
+			}
+		}
+	}
+
+	return errs.ErrorOrNil()
+}
+
+// WaitForMessages waits until n messages were written to the MockKafka and returns the first n messages.
+func (m *MockKafka) WaitForMessages(ctx context.Context, n int) ([]kafka.Message, error) {
+	for {
+		changed := m.Broker.wait()
+
+		written := m.Written()
+		if len(written) >= n {
+			return written[:n], nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return written, fmt.Errorf("waiting for %d messages, %d written: %w", n, len(written), ctx.Err())
+		case <-changed:
+		}
+	}
+}
+
+// WithKey expects the message to have the key.
+func (em *ExpectedMessage) WithKey(key []byte) *ExpectedMessage {
+	em.key = key
+	em.hasKey = true
+	return em
+}
+
+// WithValue expects the message to have the value.
+func (em *ExpectedMessage) WithValue(value []byte) *ExpectedMessage {
+	em.value = value
+	em.hasValue = true
+	return em
+}
+
+// WithHeader expects the message to have a header with the key and value.
+func (em *ExpectedMessage) WithHeader(key string, value []byte) *ExpectedMessage {
+	em.headers = append(em.headers, kafka.Header{Key: key, Value: value})
+	return em
+}
+
+// WithJSONValue expects the value of the message to be JSON equal to v, ignoring formatting and the order of fields.
+// v is a JSON document if it is a string, []byte or json.RawMessage, otherwise it is marshaled to JSON.
+func (em *ExpectedMessage) WithJSONValue(v any) *ExpectedMessage {
+	var doc []byte
+	switch v := v.(type) {
+	case string:
+		doc = []byte(v)
+	case []byte:
+		doc = v
+	case json.RawMessage:
+		doc = v
+	default:
+		doc, em.jsonErr = json.Marshal(v)
+	}
+
+	if em.jsonErr == nil {
+		em.jsonErr = json.Unmarshal(doc, &em.jsonValue)
+	}
+	em.hasJSON = true
+	return em
+}
+
+// String describes the expected message.
+func (em *ExpectedMessage) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "ExpectMessage(%q)", em.topic)
+	if em.hasKey {
+		fmt.Fprintf(&b, ".WithKey(%q)", em.key)
+	}
+	if em.hasValue {
+		fmt.Fprintf(&b, ".WithValue(%q)", em.value)
+	}
+	for _, h := range em.headers {
+		fmt.Fprintf(&b, ".WithHeader(%q, %q)", h.Key, h.Value)
+	}
+	if em.hasJSON {
+		doc, _ := json.Marshal(em.jsonValue)
+		fmt.Fprintf(&b, ".WithJSONValue(%s)", doc)
+	}
+
+	return b.String()
+}
+
+// diff returns the differences between the expectation and msg, one per line, empty if msg matches.
+func (em *ExpectedMessage) diff(msg kafka.Message) string {
+	var b strings.Builder
+
+	if em.hasKey && !bytes.Equal(em.key, msg.Key) {
+		fmt.Fprintf(&b, "\n  key:    expected %q, actual %q", em.key, msg.Key)
+	}
+	if em.hasValue && !bytes.Equal(em.value, msg.Value) {
+		fmt.Fprintf(&b, "\n  value:  expected %q, actual %q", em.value, msg.Value)
+	}
+
+	for _, h := range em.headers {
+		values := headerValues(msg.Headers, h.Key)
+		switch {
+		case len(values) == 0:
+			fmt.Fprintf(&b, "\n  header %q: missing", h.Key)
+		case !containsBytes(values, h.Value):
+			fmt.Fprintf(&b, "\n  header %q: expected %q, actual %q", h.Key, h.Value, values)
+		}
+	}
+
+	if em.hasJSON {
+		var actual any
+		switch {
+		case em.jsonErr != nil:
+			fmt.Fprintf(&b, "\n  value:  invalid expected JSON: %v", em.jsonErr)
+		case json.Unmarshal(msg.Value, &actual) != nil:
+			fmt.Fprintf(&b, "\n  value:  expected JSON, actual %q", msg.Value)
+		default:
+			for _, d := range jsonDiff("$", em.jsonValue, actual) {
+				fmt.Fprintf(&b, "\n  value:  %s", d)
+			}
+		}
+	}
+
+	return b.String()
+}
+
+// jsonDiff returns the paths where the decoded JSON documents expected and actual differ.
+func jsonDiff(path string, expected, actual any) []string {
+	switch e := expected.(type) {
+	case map[string]any:
+		a, ok := actual.(map[string]any)
+		if !ok {
+			break
+		}
+
+		keys := make([]string, 0, len(e)+len(a))
+		for k := range e {
+			keys = append(keys, k)
+		}
+		for k := range a {
+			if _, ok := e[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+
+		var diffs []string
+		for _, k := range keys {
+			ev, eok := e[k]
+			av, aok := a[k]
+			switch {
+			case !aok:
+				diffs = append(diffs, fmt.Sprintf("%s.%s: missing, expected %s", path, k, jsonString(ev)))
+			case !eok:
+				diffs = append(diffs, fmt.Sprintf("%s.%s: unexpected %s", path, k, jsonString(av)))
+			default:
+				diffs = append(diffs, jsonDiff(path+"."+k, ev, av)...)
+			}
+		}
+		return diffs
+
+	case []any:
+		a, ok := actual.([]any)
+		if !ok || len(a) != len(e) {
+			break
+		}
+
+		var diffs []string
+		for i := range e {
+			diffs = append(diffs, jsonDiff(fmt.Sprintf("%s[%d]", path, i), e[i], a[i])...)
+		}
+		return diffs
+	}
+
+	if reflect.DeepEqual(expected, actual) {
+		return nil
+	}
+	return []string{fmt.Sprintf("%s: expected %s, actual %s", path, jsonString(expected), jsonString(actual))}
+}
+
+func jsonString(v any) string {
+	doc, _ := json.Marshal(v)
+	return string(doc)
+}
+
+func headerValues(headers []kafka.Header, key string) [][]byte {
+	var values [][]byte
+	for _, h := range headers {
+		if h.Key == key {
+			values = append(values, h.Value)
+		}
+	}
+	return values
+}
+
+func containsBytes(values [][]byte, value []byte) bool {
+	for _, v := range values {
+		if bytes.Equal(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// describeMessage describes the key, value and headers of a message.
+func describeMessage(msg kafka.Message) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "key %q, value %q", msg.Key, msg.Value)
+	for _, h := range msg.Headers {
+		fmt.Fprintf(&b, ", header %q=%q", h.Key, h.Value)
+	}
+	return b.String()
+}
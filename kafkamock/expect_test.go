@@ -0,0 +1,86 @@
+package kafkamock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpectMessage(t *testing.T) {
+	mockKafka := NewMockKafka(10)
+
+	mockKafka.ExpectMessage("orders").
+		WithKey([]byte("o-1")).
+		WithHeader("trace-id", []byte("abc")).
+		WithJSONValue(map[string]any{"id": "o-1", "amount": 10})
+	mockKafka.ExpectMessage("payments").WithValue([]byte("paid"))
+	mockKafka.ExpectMessage("orders").WithJSONValue(`{"id": "o-2", "items": [1, 2]}`)
+	mockKafka.ExpectNoMoreMessages()
+
+	require.NoError(t, mockKafka.WriteMessages(context.Background(),
+		kafka.Message{
+			Topic:   "orders",
+			Key:     []byte("o-1"),
+			Value:   []byte(`{"amount":10,"id":"o-1"}`),
+			Headers: []kafka.Header{{Key: "trace-id", Value: []byte("abc")}},
+		},
+		kafka.Message{Topic: "payments", Value: []byte("paid")},
+		kafka.Message{Topic: "orders", Value: []byte(`{"items":[1,2],"id":"o-2"}`)},
+	))
+
+	assert.NoError(t, mockKafka.ExpectationsWereMet())
+}
+
+func TestExpectMessage_Mismatch(t *testing.T) {
+	mockKafka := NewMockKafka(10)
+
+	mockKafka.ExpectMessage("orders").
+		WithKey([]byte("o-1")).
+		WithHeader("trace-id", []byte("abc")).
+		WithJSONValue(`{"id": "o-1", "amount": 10, "items": [1, 2]}`)
+	mockKafka.ExpectMessage("orders")
+	mockKafka.ExpectNoMoreMessages()
+
+	require.NoError(t, mockKafka.WriteMessages(context.Background(),
+		kafka.Message{Topic: "orders", Key: []byte("o-2"), Value: []byte(`{"id":"o-1","amount":12,"items":[1,3],"note":"x"}`)},
+		kafka.Message{Topic: "payments", Value: []byte("paid")},
+	))
+
+	err := mockKafka.ExpectationsWereMet()
+	require.Error(t, err)
+
+	msg := err.Error()
+	assert.Contains(t, msg, `key:    expected "o-1", actual "o-2"`)
+	assert.Contains(t, msg, `header "trace-id": missing`)
+	assert.Contains(t, msg, `value:  $.amount: expected 10, actual 12`)
+	assert.Contains(t, msg, `value:  $.items[1]: expected 2, actual 3`)
+	assert.Contains(t, msg, `value:  $.note: unexpected "x"`)
+	assert.Contains(t, msg, `ExpectMessage("orders"): message 1 was not written`)
+	assert.Contains(t, msg, `unexpected message 0 on topic "payments": key "", value "paid"`)
+}
+
+func TestWaitForMessages(t *testing.T) {
+	mockKafka := NewMockKafka(10)
+
+	go func() {
+		for _, v := range []string{"m1", "m2"} {
+			time.Sleep(5 * time.Millisecond)
+			_ = mockKafka.WriteMessages(context.Background(), kafka.Message{Value: []byte(v)})
+		}
+	}()
+
+	msgs, err := mockKafka.WaitForMessages(context.Background(), 2)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("m1"), msgs[0].Value)
+	assert.Equal(t, []byte("m2"), msgs[1].Value)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	msgs, err = mockKafka.WaitForMessages(ctx, 3)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Len(t, msgs, 2)
+}
@@ -0,0 +1,214 @@
+package kafkamock
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// faults are the faults injected into the reads and writes of a Broker.
+// Random decisions are made by a seeded source so that tests are deterministic.
+type faults struct {
+	rng *rand.Rand
+
+	writeErrs []error
+	readErrs  []error
+
+	minLatency time.Duration
+	maxLatency time.Duration
+
+	dropRate float64
+
+	partialWrites int
+	partialRate   float64
+	partialErr    error
+
+	lostAcks int
+}
+
+func newFaults(seed uint64) faults {
+	return faults{rng: rand.New(rand.NewPCG(seed, seed))}
+}
+
+// SetFaultSeed sets the seed of the random decisions of latency, dropped messages and partial writes.
+func (b *Broker) SetFaultSeed(seed uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.faults.rng = rand.New(rand.NewPCG(seed, seed))
+}
+
+// FailWrites makes the next n writes fail with err, such as kafka.LeaderNotAvailable,
+// without writing any message. Calls queue up so a sequence of errors can be injected.
+func (b *Broker) FailWrites(n int, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for range n {
+		b.faults.writeErrs = append(b.faults.writeErrs, err)
+	}
+}
+
+// FailReads makes the next n reads fail with err, such as kafka.RequestTimedOut.
+// Calls queue up so a sequence of errors can be injected.
+func (b *Broker) FailReads(n int, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for range n {
+		b.faults.readErrs = append(b.faults.readErrs, err)
+	}
+}
+
+// SetLatency delays every read and write by a random duration between minLatency and maxLatency.
+func (b *Broker) SetLatency(minLatency, maxLatency time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.faults.minLatency = minLatency
+	b.faults.maxLatency = max(minLatency, maxLatency)
+}
+
+// DropMessages silently drops each written message with probability rate,
+// the write succeeds but the message is never stored.
+func (b *Broker) DropMessages(rate float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.faults.dropRate = rate
+}
+
+// FailPartialWrites makes the next n writes fail for each message with probability rate,
+// the other messages are written and kafka.WriteErrors is returned.
+func (b *Broker) FailPartialWrites(n int, rate float64, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.faults.partialWrites = n
+	b.faults.partialRate = rate
+	b.faults.partialErr = err
+}
+
+// LoseAcks makes the next n writes store their messages but fail with kafka.RequestTimedOut,
+// as if the acknowledgement of the broker was lost. Writers retrying them write duplicates
+// unless they are idempotent.
+func (b *Broker) LoseAcks(n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.faults.lostAcks += n
+}
+
+// ClearFaults removes all injected faults.
+func (b *Broker) ClearFaults() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.faults = faults{rng: b.faults.rng}
+}
+
+// fault is the fault injected into a read or write.
+type fault struct {
+	latency time.Duration
+	// err fails the whole read or write
+	err error
+	// errs fails individual messages of a write
+	errs kafka.WriteErrors
+	// dropped are the messages of a write that are not stored
+	dropped []bool
+	// ackErr fails a write after its messages are stored
+	ackErr error
+}
+
+// skip reports whether the message at index i of a write is not stored.
+func (f fault) skip(i int) bool {
+	return (f.errs != nil && f.errs[i] != nil) || (f.dropped != nil && f.dropped[i])
+}
+
+// writeFault decides the fault of a write of n messages.
+func (b *Broker) writeFault(n int) fault {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	f := &b.faults
+	wf := fault{latency: f.latency()}
+
+	if len(f.writeErrs) > 0 {
+		wf.err = f.writeErrs[0]
+		f.writeErrs = f.writeErrs[1:]
+		return wf
+	}
+
+	if f.lostAcks > 0 {
+		f.lostAcks--
+		wf.ackErr = kafka.RequestTimedOut
+	}
+
+	if f.partialWrites > 0 {
+		f.partialWrites--
+		for i := range n {
+			if f.rng.Float64() < f.partialRate {
+				if wf.errs == nil {
+					wf.errs = make(kafka.WriteErrors, n)
+				}
+				wf.errs[i] = f.partialErr
+			}
+		}
+	}
+
+	if f.dropRate > 0 {
+		wf.dropped = make([]bool, n)
+		for i := range wf.dropped {
+			wf.dropped[i] = f.rng.Float64() < f.dropRate
+		}
+	}
+
+	return wf
+}
+
+// readFault decides the fault of a read.
+func (b *Broker) readFault() fault {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	f := &b.faults
+	rf := fault{latency: f.latency()}
+
+	if len(f.readErrs) > 0 {
+		rf.err = f.readErrs[0]
+		f.readErrs = f.readErrs[1:]
+	}
+
+	return rf
+}
+
+func (f *faults) latency() time.Duration {
+	if f.maxLatency <= 0 {
+		return 0
+	}
+	if f.maxLatency == f.minLatency {
+		return f.minLatency
+	}
+	return f.minLatency + time.Duration(f.rng.Int64N(int64(f.maxLatency-f.minLatency)))
+}
+
+// sleep waits for d or until ctx or done is done.
+func sleep(ctx context.Context, done <-chan struct{}, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-done:
+		return nil
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,113 @@
+package kafkamock
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFaults_FailWrites(t *testing.T) {
+	mockKafka := NewMockKafka(10)
+	mockKafka.FailWrites(2, kafka.LeaderNotAvailable)
+	mockKafka.FailWrites(1, kafka.RequestTimedOut)
+
+	msg := kafka.Message{Value: []byte("retry")}
+	assert.ErrorIs(t, mockKafka.WriteMessages(context.Background(), msg), kafka.LeaderNotAvailable)
+	assert.ErrorIs(t, mockKafka.WriteMessages(context.Background(), msg), kafka.LeaderNotAvailable)
+	assert.ErrorIs(t, mockKafka.WriteMessages(context.Background(), msg), kafka.RequestTimedOut)
+	assert.NoError(t, mockKafka.WriteMessages(context.Background(), msg))
+
+	assert.Len(t, mockKafka.Messages(DefaultTopic, 0), 1, "failed writes store no message")
+}
+
+func TestFaults_FailReads(t *testing.T) {
+	mockKafka := NewMockKafka(10)
+	require.NoError(t, mockKafka.WriteMessages(context.Background(), kafka.Message{Value: []byte("m1")}))
+
+	mockKafka.FailReads(1, kafka.RequestTimedOut)
+	_, err := mockKafka.ReadMessage(context.Background())
+	assert.ErrorIs(t, err, kafka.RequestTimedOut)
+
+	msg, err := mockKafka.ReadMessage(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []byte("m1"), msg.Value, "failed reads do not consume messages")
+}
+
+func TestFaults_Latency(t *testing.T) {
+	mockKafka := NewMockKafka(10)
+	mockKafka.SetLatency(20*time.Millisecond, 20*time.Millisecond)
+
+	start := time.Now()
+	require.NoError(t, mockKafka.WriteMessages(context.Background(), kafka.Message{Value: []byte("slow")}))
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	_, err := mockKafka.ReadMessage(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	mockKafka.ClearFaults()
+	start = time.Now()
+	_, err = mockKafka.ReadMessage(context.Background())
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), 20*time.Millisecond)
+}
+
+// partialWrite writes a batch with partial write failures and returns the indexes of the failed messages.
+func partialWrite(t *testing.T, seed uint64) []int {
+	t.Helper()
+
+	broker := NewBroker(1)
+	broker.SetFaultSeed(seed)
+	broker.FailPartialWrites(1, 0.5, kafka.NotEnoughReplicas)
+
+	var msgs []kafka.Message
+	for i := 0; i < 20; i++ {
+		msgs = append(msgs, kafka.Message{Value: []byte(fmt.Sprintf("m%d", i))})
+	}
+
+	writer := NewBrokerWriter(broker, nil)
+	err := writer.WriteMessages(context.Background(), msgs...)
+
+	var errs kafka.WriteErrors
+	require.ErrorAs(t, err, &errs)
+	require.Len(t, errs, len(msgs))
+
+	var failed []int
+	for i, err := range errs {
+		if err != nil {
+			assert.ErrorIs(t, err, kafka.NotEnoughReplicas)
+			failed = append(failed, i)
+		}
+	}
+	assert.Len(t, broker.Messages(DefaultTopic, 0), len(msgs)-len(failed), "other messages are written")
+
+	// the next write is not affected
+	require.NoError(t, writer.WriteMessages(context.Background(), msgs...))
+
+	return failed
+}
+
+func TestFaults_FailPartialWrites(t *testing.T) {
+	failed := partialWrite(t, 42)
+	assert.NotEmpty(t, failed)
+	assert.Equal(t, failed, partialWrite(t, 42), "faults are deterministic for a seed")
+}
+
+func TestFaults_DropMessages(t *testing.T) {
+	broker := NewBroker(1)
+	broker.DropMessages(1)
+
+	writer := NewBrokerWriter(broker, nil)
+	require.NoError(t, writer.WriteMessages(context.Background(), kafka.Message{Value: []byte("lost")}))
+	assert.Empty(t, broker.Messages(DefaultTopic, 0))
+
+	broker.DropMessages(0)
+	require.NoError(t, writer.WriteMessages(context.Background(), kafka.Message{Value: []byte("kept")}))
+	assert.Len(t, broker.Messages(DefaultTopic, 0), 1)
+}
@@ -0,0 +1,160 @@
+package kafkamock
+
+import (
+	"slices"
+	"sort"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type topicPartition struct {
+	topic     string
+	partition int
+}
+
+// group is a consumer group, its partitions are split across the members in join order
+// and offsets committed by any member persist after the member leaves.
+type group struct {
+	members   []*MockReader
+	committed map[topicPartition]int64
+}
+
+// join adds a reader to its consumer group, creating the group if needed.
+func (b *Broker) join(groupID string, m *MockReader) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	g := b.group(groupID)
+	g.members = append(g.members, m)
+	b.notify()
+}
+
+// leave removes a reader from its consumer group, its partitions are assigned to the remaining members.
+func (b *Broker) leave(groupID string, m *MockReader) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	g := b.group(groupID)
+	g.members = slices.DeleteFunc(g.members, func(member *MockReader) bool {
+		return member == m
+	})
+	b.notify()
+}
+
+// group returns the consumer group, creating it if needed. The caller must hold b.mu.
+func (b *Broker) group(groupID string) *group {
+	g, ok := b.groups[groupID]
+	if !ok {
+		g = &group{committed: make(map[topicPartition]int64)}
+		b.groups[groupID] = g
+	}
+	return g
+}
+
+// assignment returns the partitions of topics assigned to a member of the consumer group,
+// partitions are assigned round-robin in the order members joined.
+func (b *Broker) assignment(groupID string, m *MockReader, topics []string) []topicPartition {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	g := b.group(groupID)
+	idx := slices.Index(g.members, m)
+	if idx < 0 {
+		return nil
+	}
+
+	topics = slices.Clone(topics)
+	sort.Strings(topics)
+
+	var assigned []topicPartition
+	i := 0
+	for _, name := range topics {
+		t, ok := b.topics[name]
+		if !ok {
+			continue
+		}
+		for p := range t.partitions {
+			if i%len(g.members) == idx {
+				assigned = append(assigned, topicPartition{topic: name, partition: p})
+			}
+			i++
+		}
+	}
+
+	return assigned
+}
+
+// startOffset returns the offset a member of the consumer group starts reading a partition from:
+// the committed offset, or the first or last offset of the partition by startOffset.
+func (b *Broker) startOffset(groupID string, tp topicPartition, startOffset int64) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if offset, ok := b.group(groupID).committed[tp]; ok {
+		return offset
+	}
+
+	p, _ := b.partition(tp.topic, tp.partition)
+	if p == nil {
+		return 0
+	}
+	if startOffset == kafka.LastOffset {
+		return p.nextOffset
+	}
+	return p.startOffset
+}
+
+// commit commits the offsets of the consumer group, committed offsets never move backwards.
+func (b *Broker) commit(groupID string, offsets map[topicPartition]int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.group(groupID).commit(offsets)
+}
+
+// commit commits the offsets, committed offsets never move backwards. The caller must hold b.mu.
+func (g *group) commit(offsets map[topicPartition]int64) {
+	for tp, offset := range offsets {
+		if committed, ok := g.committed[tp]; !ok || offset > committed {
+			g.committed[tp] = offset
+		}
+	}
+}
+
+// CommittedOffsets returns the offsets committed by the consumer group for the partitions of the topic,
+// partitions without a committed offset are omitted.
+func (b *Broker) CommittedOffsets(groupID, topic string) map[int]int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	offsets := make(map[int]int64)
+	for tp, offset := range b.group(groupID).committed {
+		if tp.topic == topic {
+			offsets[tp.partition] = offset
+		}
+	}
+	return offsets
+}
+
+// GroupLag returns the lag of the consumer group for each partition of the topic,
+// the number of messages after the committed offset.
+func (b *Broker) GroupLag(groupID, topic string) map[int]int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t, ok := b.topics[topic]
+	if !ok {
+		return nil
+	}
+
+	g := b.group(groupID)
+	lag := make(map[int]int64, len(t.partitions))
+	for i, p := range t.partitions {
+		committed, ok := g.committed[topicPartition{topic: topic, partition: i}]
+		if !ok {
+			committed = p.startOffset
+		}
+		lag[i] = p.nextOffset - max(committed, p.startOffset)
+	}
+	return lag
+}
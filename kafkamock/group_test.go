@@ -0,0 +1,127 @@
+package kafkamock
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeOrders(t *testing.T, broker *Broker, n int) {
+	t.Helper()
+
+	writer := NewBrokerWriter(broker, &kafka.Writer{Topic: "orders", Balancer: &kafka.RoundRobin{}})
+	for i := 0; i < n; i++ {
+		require.NoError(t, writer.WriteMessages(context.Background(), kafka.Message{Value: []byte(fmt.Sprintf("order-%d", i))}))
+	}
+}
+
+func readAll(t *testing.T, reader *MockReader, fetch bool) []kafka.Message {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	var msgs []kafka.Message
+	for {
+		var msg kafka.Message
+		var err error
+		if fetch {
+			msg, err = reader.FetchMessage(ctx)
+		} else {
+			msg, err = reader.ReadMessage(ctx)
+		}
+		if err != nil {
+			return msgs
+		}
+		msgs = append(msgs, msg)
+	}
+}
+
+func TestConsumerGroup_SplitPartitions(t *testing.T) {
+	broker := NewBroker(1)
+	require.NoError(t, broker.CreateTopic("orders", 4))
+	writeOrders(t, broker, 8)
+
+	r1 := NewBrokerReader(broker, kafka.ReaderConfig{Topic: "orders", GroupID: "billing"})
+	r2 := NewBrokerReader(broker, kafka.ReaderConfig{Topic: "orders", GroupID: "billing"})
+
+	msgs1 := readAll(t, r1, false)
+	msgs2 := readAll(t, r2, false)
+	assert.Len(t, msgs1, 4)
+	assert.Len(t, msgs2, 4)
+
+	partitions := make(map[int]bool)
+	for _, msg := range msgs1 {
+		partitions[msg.Partition] = true
+	}
+	for _, msg := range msgs2 {
+		assert.False(t, partitions[msg.Partition], "partition %d is read by both members", msg.Partition)
+	}
+
+	// another group reads all messages independently
+	r3 := NewBrokerReader(broker, kafka.ReaderConfig{Topic: "orders", GroupID: "audit"})
+	assert.Len(t, readAll(t, r3, false), 8)
+}
+
+func TestConsumerGroup_Redelivery(t *testing.T) {
+	broker := NewBroker(1)
+	require.NoError(t, broker.CreateTopic("orders", 2))
+	writeOrders(t, broker, 4)
+
+	r1 := NewBrokerReader(broker, kafka.ReaderConfig{Topic: "orders", GroupID: "billing"})
+	r2 := NewBrokerReader(broker, kafka.ReaderConfig{Topic: "orders", GroupID: "billing"})
+
+	fetched := readAll(t, r1, true)
+	require.Len(t, fetched, 2)
+	require.NoError(t, r1.CommitMessages(context.Background(), fetched[0]))
+
+	assert.Len(t, readAll(t, r2, false), 2)
+
+	// the uncommitted message of r1 is delivered again to r2 after r1 leaves
+	require.NoError(t, r1.Close())
+	redelivered := readAll(t, r2, false)
+	require.Len(t, redelivered, 1)
+	assert.Equal(t, fetched[1].Value, redelivered[0].Value)
+}
+
+func TestConsumerGroup_CommittedOffsetsPersist(t *testing.T) {
+	broker := NewBroker(1)
+	writeOrders(t, broker, 3)
+
+	reader := NewBrokerReader(broker, kafka.ReaderConfig{Topic: "orders", GroupID: "billing"})
+	msg, err := reader.FetchMessage(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, reader.CommitMessages(context.Background(), msg))
+	require.NoError(t, reader.Close())
+
+	assert.Equal(t, map[int]int64{0: 1}, broker.CommittedOffsets("billing", "orders"))
+	assert.Equal(t, map[int]int64{0: 2}, broker.GroupLag("billing", "orders"))
+
+	reader = NewBrokerReader(broker, kafka.ReaderConfig{Topic: "orders", GroupID: "billing"})
+	msgs := readAll(t, reader, false)
+	require.Len(t, msgs, 2)
+	assert.Equal(t, []byte("order-1"), msgs[0].Value)
+	assert.Equal(t, map[int]int64{0: 0}, broker.GroupLag("billing", "orders"))
+
+	require.NoError(t, reader.Close())
+	assert.Error(t, reader.CommitMessages(context.Background(), msgs...), "closed readers can not commit")
+
+	nogroup := NewBrokerReader(broker, kafka.ReaderConfig{Topic: "orders"})
+	assert.Error(t, nogroup.CommitMessages(context.Background(), msgs...))
+}
+
+func TestConsumerGroup_StartOffset(t *testing.T) {
+	broker := NewBroker(1)
+	writeOrders(t, broker, 3)
+
+	reader := NewBrokerReader(broker, kafka.ReaderConfig{Topic: "orders", GroupID: "billing", StartOffset: kafka.LastOffset})
+	assert.Empty(t, readAll(t, reader, false))
+
+	writeOrders(t, broker, 1)
+	assert.Len(t, readAll(t, reader, false), 1)
+}
@@ -3,6 +3,7 @@ package kafkamock
 import (
 	"context"
 	"errors"
+	"io"
 	"sync"
 
 	"github.com/segmentio/kafka-go"
@@ -10,60 +11,294 @@ import (
 
 // MockReader simulates the kafka.Reader interface
 type MockReader struct {
-	messages chan *kafka.Message
-	mu       sync.Mutex
-	closed   bool
+	broker    *Broker
+	config    kafka.ReaderConfig
+	mu        sync.Mutex
+	positions map[topicPartition]int64
+	next      int
+	closed    bool
+	done      chan struct{}
+	stats     readerStats
+
+	// source are the messages of a reader created by NewMockReader, moved to the broker as they are read.
+	source chan *kafka.Message
 }
 
-// NewMockReader creates a new MockReader
+// NewMockReader creates a new MockReader reading the messages of a channel, such as the channel of a MockWriter
+// created by NewMockWriter. The messages are read through a broker of its own, see NewBrokerReader.
+// It returns io.EOF once the channel is closed and its messages are read.
 func NewMockReader(messages chan *kafka.Message) *MockReader {
-	return &MockReader{
-		messages: messages,
+	m := NewBrokerReader(NewBroker(1), kafka.ReaderConfig{})
+	m.source = messages
+	return m
+}
+
+// NewBrokerReader creates a new MockReader reading from broker.
+// Without a GroupID it reads the Topic and Partition of config, DefaultTopic if no topic is set.
+// With a GroupID it joins the consumer group and reads the partitions of Topic or GroupTopics
+// assigned to it, starting from the offsets committed by the group.
+func NewBrokerReader(broker *Broker, config kafka.ReaderConfig) *MockReader {
+	if config.Topic == "" && len(config.GroupTopics) == 0 {
+		config.Topic = DefaultTopic
 	}
+
+	m := &MockReader{
+		broker:    broker,
+		config:    config,
+		positions: make(map[topicPartition]int64),
+		done:      make(chan struct{}),
+	}
+	if config.GroupID != "" {
+		broker.join(config.GroupID, m)
+	}
+	return m
+}
+
+// Config returns the reader configuration
+func (m *MockReader) Config() kafka.ReaderConfig {
+	return m.config
 }
 
-// ReadMessage simulates reading a message
+// ReadMessage reads a message, blocking until a message is available or ctx is done.
+// With a GroupID the offset of the message is committed.
+// It returns io.EOF once the reader is closed.
 func (m *MockReader) ReadMessage(ctx context.Context) (kafka.Message, error) {
+	return m.read(ctx, m.config.GroupID != "")
+}
+
+// FetchMessage fetches a message without committing its offset, blocking until a message
+// is available or ctx is done. The offset should be committed by CommitMessages once processed.
+func (m *MockReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	return m.read(ctx, false)
+}
+
+// read reads the next message and records it in the reader statistics.
+func (m *MockReader) read(ctx context.Context, commit bool) (kafka.Message, error) {
+	msg, err := m.receive(ctx, commit)
+
+	m.mu.Lock()
+	m.stats.record(msg, err)
+	m.mu.Unlock()
+
+	return msg, err
+}
+
+// receive waits for the next message, the reader mutex is not held while waiting
+// so that Close is not blocked by a pending read.
+func (m *MockReader) receive(ctx context.Context, commit bool) (kafka.Message, error) {
+	m.mu.Lock()
+	closed := m.closed
+	m.mu.Unlock()
+	if closed {
+		return kafka.Message{}, io.EOF
+	}
+
+	f := m.broker.readFault()
+	if err := sleep(ctx, m.done, f.latency); err != nil {
+		return kafka.Message{}, err
+	}
+	if f.err != nil {
+		return kafka.Message{}, f.err
+	}
+
+	for {
+		m.mu.Lock()
+		if m.closed {
+			m.mu.Unlock()
+			return kafka.Message{}, io.EOF
+		}
+
+		// wait for changes made after the fetch
+		changed := m.broker.wait()
+		msg, ok, err := m.fetch()
+		if ok && commit {
+			m.broker.commit(m.config.GroupID, commitOffsets(msg))
+		}
+		m.mu.Unlock()
+
+		if err != nil {
+			return kafka.Message{}, err
+		}
+		if ok {
+			return msg, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return kafka.Message{}, ctx.Err()
+		case <-m.done:
+			return kafka.Message{}, io.EOF
+		case <-changed:
+		case msg, ok := <-m.source:
+			if !ok {
+				return kafka.Message{}, io.EOF
+			}
+			written := *msg
+			written.Topic = ""
+			if _, err := m.broker.produce(m.config.Topic, &kafka.Hash{}, []kafka.Message{written}); err != nil {
+				return kafka.Message{}, err
+			}
+		}
+	}
+}
+
+// CommitMessages commits the offsets of the messages for the consumer group.
+func (m *MockReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if m.config.GroupID == "" {
+		return errors.New("unavailable when GroupID is not set")
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	if m.closed {
-		return kafka.Message{}, errors.New("reader is closed")
+		return errors.New("reader is closed")
 	}
 
-	if len(m.messages) == 0 {
-		return kafka.Message{}, errors.New("no more messages")
+	m.broker.commit(m.config.GroupID, commitOffsets(msgs...))
+	return nil
+}
+
+// fetch returns the next message of the partitions read, false if there is none yet.
+// The caller must hold m.mu.
+func (m *MockReader) fetch() (kafka.Message, bool, error) {
+	tps := m.assignment()
+	for i := range tps {
+		tp := tps[(m.next+i)%len(tps)]
+
+		msg, ok, err := m.broker.fetch(tp.topic, tp.partition, m.positions[tp], m.config.IsolationLevel)
+		if err != nil {
+			return kafka.Message{}, false, err
+		}
+		if !ok {
+			continue
+		}
+
+		// continue with the next partition so that no partition is starved
+		m.next = (m.next + i + 1) % len(tps)
+		m.positions[tp] = msg.Offset + 1
+		return msg, true, nil
 	}
 
-	msg := <-m.messages
+	return kafka.Message{}, false, nil
+}
 
-	return *msg, nil
+// assignment returns the partitions read and updates their positions, newly assigned partitions
+// of a consumer group start from the committed offsets. The caller must hold m.mu.
+func (m *MockReader) assignment() []topicPartition {
+	if m.config.GroupID == "" {
+		return []topicPartition{{topic: m.config.Topic, partition: m.config.Partition}}
+	}
+
+	topics := m.config.GroupTopics
+	if len(topics) == 0 {
+		topics = []string{m.config.Topic}
+	}
+
+	tps := m.broker.assignment(m.config.GroupID, m, topics)
+	if len(tps) != len(m.positions) {
+		m.stats.rebalances++
+	} else {
+		for _, tp := range tps {
+			if _, ok := m.positions[tp]; !ok {
+				m.stats.rebalances++
+				break
+			}
+		}
+	}
+
+	positions := make(map[topicPartition]int64, len(tps))
+	for _, tp := range tps {
+		if offset, ok := m.positions[tp]; ok {
+			positions[tp] = offset
+		} else {
+			positions[tp] = m.broker.startOffset(m.config.GroupID, tp, m.config.StartOffset)
+		}
+	}
+	m.positions = positions
+
+	return tps
 }
 
-// Close closes the MockReader
+// commitOffsets returns the offsets to commit for messages, the offset after the last message of each partition.
+func commitOffsets(msgs ...kafka.Message) map[topicPartition]int64 {
+	offsets := make(map[topicPartition]int64)
+	for _, msg := range msgs {
+		tp := topicPartition{topic: msg.Topic, partition: msg.Partition}
+		if offset, ok := offsets[tp]; !ok || msg.Offset+1 > offset {
+			offsets[tp] = msg.Offset + 1
+		}
+	}
+	return offsets
+}
+
+// Close closes the MockReader, it leaves its consumer group so the partitions are reassigned
+// and messages not committed are delivered again to the other members.
 func (m *MockReader) Close() error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+
+	if m.closed {
+		return nil
+	}
+
+	if m.config.GroupID != "" {
+		m.broker.leave(m.config.GroupID, m)
+	}
 	m.closed = true
+	close(m.done)
 	return nil
 }
 
 // MockWriter simulates the kafka.Writer interface
 type MockWriter struct {
-	messages chan *kafka.Message
+	broker   *Broker
+	topic    string
+	balancer kafka.Balancer
 	mu       sync.Mutex
 	closed   bool
+
+	// batcher batches messages, nil if messages are written immediately.
+	batcher *batcher
+	// messages receive the messages written by a writer created by NewMockWriter.
+	messages chan *kafka.Message
 }
 
-// NewMockWriter creates a new MockWriter
+// NewMockWriter creates a new MockWriter writing to a broker of its own, see NewBrokerWriter,
+// and sending the messages written to a channel. WriteMessages blocks while the channel is full.
 func NewMockWriter(messages chan *kafka.Message) *MockWriter {
+	m := NewBrokerWriter(NewBroker(1), nil)
+	m.messages = messages
+	return m
+}
+
+// NewBrokerWriter creates a new MockWriter writing to broker.
+// The Topic and Balancer of config are honoured, config is not used to connect to kafka and may be nil.
+// Without a balancer messages are partitioned by kafka.Hash, so keyed messages land on the same
+// partition as with a real kafka.Writer using kafka.Hash.
+func NewBrokerWriter(broker *Broker, config *kafka.Writer) *MockWriter {
+	if config == nil {
+		config = &kafka.Writer{}
+	}
+
+	balancer := config.Balancer
+	if balancer == nil {
+		balancer = &kafka.Hash{}
+	}
+
 	return &MockWriter{
-		messages: messages,
+		broker:   broker,
+		topic:    config.Topic,
+		balancer: balancer,
 	}
 }
 
 // WriteMessages simulates writing messages
 func (m *MockWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if m.batcher != nil {
+		return m.writeBatched(ctx, msgs)
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -71,50 +306,116 @@ func (m *MockWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) e
 		return errors.New("writer is closed")
 	}
 
-	for i := range msgs {
-		m.messages <- &msgs[i]
+	f := m.broker.writeFault(len(msgs))
+	if err := sleep(ctx, nil, f.latency); err != nil {
+		return err
+	}
+	if f.err != nil {
+		return f.err
+	}
+
+	written := make([]kafka.Message, 0, len(msgs))
+	for i, msg := range msgs {
+		if !f.skip(i) {
+			written = append(written, msg)
+		}
+	}
+
+	written, err := m.broker.produce(m.topic, m.balancer, written)
+	if err != nil {
+		return err
+	}
+	if m.messages != nil {
+		for i := range written {
+			m.messages <- &written[i]
+		}
+	}
+	if f.ackErr != nil {
+		return f.ackErr
+	}
+	if f.errs != nil {
+		return f.errs
 	}
 	return nil
 }
 
-// Close closes the MockWriter
+// Close closes the MockWriter, a batched writer writes its pending batches.
 func (m *MockWriter) Close() error {
+	if m.batcher != nil {
+		m.batcher.close()
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.closed = true
 	return nil
 }
 
-// MockKafka contains MockReader and MockWriter
+// MockKafka contains a Broker, and a MockReader and MockWriter of DefaultTopic
 type MockKafka struct {
+	*Broker
 	*MockReader
 	*MockWriter
 	messages chan *kafka.Message
+
+	// log are the messages written, in order, guarded by Broker.mu.
+	log    []kafka.Message
+	expect expectations
 }
 
-// NewMockKafka creates a new MockKafka
+// NewMockKafka creates a new MockKafka with a single partition per topic.
+// size is the capacity of the channel returned by GetMessages, messages are dropped from the channel
+// once it is full, see GetMessages.
 func NewMockKafka(size int) *MockKafka {
-	messages := make(chan *kafka.Message, size)
-	return &MockKafka{
-		MockReader: NewMockReader(messages),
-		MockWriter: NewMockWriter(messages),
-		messages:   messages,
+	broker := NewBroker(1)
+	m := &MockKafka{
+		Broker:     broker,
+		MockReader: NewBrokerReader(broker, kafka.ReaderConfig{}),
+		MockWriter: NewBrokerWriter(broker, nil),
+		messages:   make(chan *kafka.Message, size),
+	}
+
+	broker.tap = func(msg kafka.Message) {
+		m.log = append(m.log, msg)
+		// the broker is locked, blocking would block all the readers and writers
+		select {
+		case m.messages <- &msg:
+		default:
+		}
 	}
+
+	return m
 }
 
 // Close closes the MockKafka
 func (m *MockKafka) Close() error {
 	m.MockReader.Close()
 	m.MockWriter.Close()
+
+	m.Broker.mu.Lock()
+	defer m.Broker.mu.Unlock()
+	m.Broker.tap = nil
 	close(m.messages)
 	return nil
 }
 
-// GetMessages gets the message channel of MockKafka
+// GetMessages gets the channel receiving the messages written to the MockKafka.
+//
+// The channel is lossy: writes do not block while it is full, and the messages written meanwhile are
+// NOT sent to the channel, they are only kept by the broker. Use Written or WaitForMessages to get
+// every message written.
 func (m *MockKafka) GetMessages() chan *kafka.Message {
 	return m.messages
 }
 
+// Written returns all the messages written to the MockKafka, in order, of all the topics.
+func (m *MockKafka) Written() []kafka.Message {
+	m.Broker.mu.Lock()
+	defer m.Broker.mu.Unlock()
+
+	return append([]kafka.Message(nil), m.log...)
+}
+
 // MockKafkaInterface defines an interface to easily replace the real Kafka client
 type MockKafkaInterface interface {
 	ReadMessage(ctx context.Context) (kafka.Message, error)
@@ -2,7 +2,9 @@ package kafkamock
 
 import (
 	"context"
+	"io"
 	"testing"
+	"time"
 
 	"github.com/segmentio/kafka-go"
 	"github.com/stretchr/testify/assert"
@@ -27,9 +29,11 @@ func TestMockKafka(t *testing.T) {
 		assert.Equal(t, expectedMsg.Value, msg.Value, "expected message values to be equal")
 	}
 
-	// Test reading from empty queue
-	_, err = mockKafka.ReadMessage(context.Background())
-	assert.Error(t, err, "expected error when reading from empty queue")
+	// Test reading from empty queue blocks until the context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = mockKafka.ReadMessage(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded, "expected context error when reading from empty queue")
 
 	// Test closing MockKafka
 	err = mockKafka.Close()
@@ -41,5 +45,95 @@ func TestMockKafka(t *testing.T) {
 
 	// Test reading after closing
 	_, err = mockKafka.ReadMessage(context.Background())
-	assert.Error(t, err, "expected error when reading after closing")
+	assert.ErrorIs(t, err, io.EOF, "expected io.EOF when reading after closing")
+}
+
+func TestMockReader_Blocking(t *testing.T) {
+	mockKafka := NewMockKafka(10)
+
+	// a pending read receives the message written afterwards
+	received := make(chan kafka.Message)
+	go func() {
+		msg, err := mockKafka.ReadMessage(context.Background())
+		assert.NoError(t, err)
+		received <- msg
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	err := mockKafka.WriteMessages(context.Background(), kafka.Message{Value: []byte("late")})
+	assert.NoError(t, err)
+
+	select {
+	case msg := <-received:
+		assert.Equal(t, []byte("late"), msg.Value)
+	case <-time.After(time.Second):
+		t.Fatal("pending read was not woken up by the write")
+	}
+
+	// a pending read is canceled by its context
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error)
+	go func() {
+		_, err := mockKafka.ReadMessage(ctx)
+		errs <- err
+	}()
+	cancel()
+	assert.ErrorIs(t, <-errs, context.Canceled)
+
+	// Close is not blocked by a pending read, which returns io.EOF
+	go func() {
+		_, err := mockKafka.ReadMessage(context.Background())
+		errs <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	assert.NoError(t, mockKafka.Close())
+
+	select {
+	case err := <-errs:
+		assert.ErrorIs(t, err, io.EOF)
+	case <-time.After(time.Second):
+		t.Fatal("pending read was not woken up by Close")
+	}
+}
+
+func TestMockReaderWriter_Channel(t *testing.T) {
+	messages := make(chan *kafka.Message, 10)
+	writer := NewMockWriter(messages)
+	reader := NewMockReader(messages)
+
+	err := writer.WriteMessages(context.Background(), kafka.Message{Value: []byte("message1")}, kafka.Message{Value: []byte("message2")})
+	assert.NoError(t, err)
+
+	for _, want := range []string{"message1", "message2"} {
+		msg, err := reader.ReadMessage(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, want, string(msg.Value))
+	}
+
+	// the reader reads the messages sent to the channel after it blocked
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		messages <- &kafka.Message{Value: []byte("message3")}
+		close(messages)
+	}()
+	msg, err := reader.ReadMessage(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "message3", string(msg.Value))
+
+	_, err = reader.ReadMessage(context.Background())
+	assert.ErrorIs(t, err, io.EOF, "expected io.EOF once the channel is closed")
+}
+
+func TestMockKafka_Written(t *testing.T) {
+	mockKafka := NewMockKafka(1)
+	defer mockKafka.Close()
+
+	err := mockKafka.WriteMessages(context.Background(), kafka.Message{Value: []byte("message1")}, kafka.Message{Value: []byte("message2")})
+	assert.NoError(t, err, "writes do not block on a full channel")
+
+	assert.Len(t, mockKafka.GetMessages(), 1, "messages written to a full channel are dropped")
+	written := mockKafka.Written()
+	if assert.Len(t, written, 2) {
+		assert.Equal(t, "message2", string(written[1].Value))
+	}
 }
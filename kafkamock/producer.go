@@ -0,0 +1,464 @@
+package kafkamock
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+var errNotTransactional = errors.New("producer is not transactional")
+
+// producerState is the state the broker keeps for an idempotent producer.
+type producerState struct {
+	epoch int16
+	// sequences are the next sequence numbers expected by partition.
+	sequences map[topicPartition]int32
+	// txn is the open transaction, nil if there is none.
+	txn *transaction
+}
+
+// transaction are the messages and group offsets of an open transaction.
+type transaction struct {
+	offsets      map[topicPartition][]int64
+	groupOffsets map[string]map[topicPartition]int64
+}
+
+// sequencedBatch are the messages of a write to a partition, numbered from baseSequence.
+type sequencedBatch struct {
+	tp           topicPartition
+	baseSequence int32
+	msgs         []kafka.Message
+}
+
+// MockProducer is an idempotent, optionally transactional, producer.
+//
+// Messages are numbered by partition and writes failing with a temporary error are retried with the
+// same sequence numbers, the broker discards the messages it already stored so a retry never writes
+// duplicates. Messages written in a transaction are not visible to readers with kafka.ReadCommitted
+// until the transaction is committed, and never if it is aborted.
+//
+// Faults of the broker are injected into every attempt: a partition with a message failed by FailPartialWrites
+// is not written and fails the attempt, messages dropped by DropMessages are acknowledged but not stored.
+type MockProducer struct {
+	broker          *Broker
+	topic           string
+	balancer        kafka.Balancer
+	maxAttempts     int
+	transactionalID string
+
+	mu        sync.Mutex
+	id        int64
+	epoch     int16
+	sequences map[topicPartition]int32
+	inTxn     bool
+	closed    bool
+}
+
+// NewMockProducer creates a new MockProducer writing to broker. The Topic, Balancer and MaxAttempts of
+// config are honoured, config may be nil. Retries are not delayed by the backoff of config.
+//
+// With a transactionalID the producer is transactional, it fences the previous producer with the same
+// transactionalID: the open transaction of that producer is aborted and its writes fail with kafka.InvalidProducerEpoch.
+func NewMockProducer(broker *Broker, config *kafka.Writer, transactionalID string) *MockProducer {
+	if config == nil {
+		config = &kafka.Writer{}
+	}
+
+	balancer := config.Balancer
+	if balancer == nil {
+		balancer = &kafka.Hash{}
+	}
+	maxAttempts := config.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 10
+	}
+
+	id, epoch := broker.initProducer(transactionalID)
+	return &MockProducer{
+		broker:          broker,
+		topic:           config.Topic,
+		balancer:        balancer,
+		maxAttempts:     maxAttempts,
+		transactionalID: transactionalID,
+		id:              id,
+		epoch:           epoch,
+		sequences:       make(map[topicPartition]int32),
+	}
+}
+
+// ProducerID returns the producer id and epoch assigned by the broker.
+func (m *MockProducer) ProducerID() (int64, int16) {
+	return m.id, m.epoch
+}
+
+// WriteMessages writes messages, retrying temporary errors up to MaxAttempts times.
+// A transactional producer must write in a transaction. The messages of a write failing once
+// the attempts are exhausted may be stored, writing them again writes duplicates.
+func (m *MockProducer) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return errors.New("producer is closed")
+	}
+	if m.transactionalID != "" && !m.inTxn {
+		return kafka.InvalidTransactionState
+	}
+
+	tps, err := m.broker.routeAll(m.topic, m.balancer, msgs)
+	if err != nil {
+		return err
+	}
+
+	var batches []*sequencedBatch
+	byPartition := make(map[topicPartition]*sequencedBatch)
+	for i, msg := range msgs {
+		batch, ok := byPartition[tps[i]]
+		if !ok {
+			batch = &sequencedBatch{tp: tps[i], baseSequence: m.sequences[tps[i]]}
+			byPartition[tps[i]] = batch
+			batches = append(batches, batch)
+		}
+		batch.msgs = append(batch.msgs, msg)
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = m.write(ctx, batches)
+
+		var kerr kafka.Error
+		if err == nil || !errors.As(err, &kerr) || !kerr.Temporary() || attempt >= m.maxAttempts {
+			break
+		}
+	}
+	if err != nil {
+		// the failed write may be stored, as when its acknowledgement is lost: the next write continues
+		// from the sequence numbers of the broker, or it would be discarded as a retry of this write
+		for _, batch := range batches {
+			if sequence, ok := m.broker.nextSequence(m.id, m.epoch, batch.tp); ok {
+				m.sequences[batch.tp] = sequence
+			}
+		}
+		return err
+	}
+
+	for _, batch := range batches {
+		m.sequences[batch.tp] = batch.baseSequence + int32(len(batch.msgs))
+	}
+	return nil
+}
+
+// write makes an attempt to write the batches, faults of the broker are injected.
+func (m *MockProducer) write(ctx context.Context, batches []*sequencedBatch) error {
+	n := 0
+	for _, batch := range batches {
+		n += len(batch.msgs)
+	}
+
+	f := m.broker.writeFault(n)
+	if err := sleep(ctx, nil, f.latency); err != nil {
+		return err
+	}
+	if f.err != nil {
+		return f.err
+	}
+
+	if err := m.broker.appendSequenced(m.id, m.epoch, m.inTxn, batches, f); err != nil {
+		return err
+	}
+	return f.ackErr
+}
+
+// BeginTxn begins a transaction.
+func (m *MockProducer) BeginTxn() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.transactionalID == "" {
+		return errNotTransactional
+	}
+	if m.inTxn {
+		return kafka.InvalidTransactionState
+	}
+	if err := m.broker.beginTxn(m.id, m.epoch); err != nil {
+		return err
+	}
+
+	m.inTxn = true
+	return nil
+}
+
+// SendOffsetsToTxn commits the offsets of consumed messages for the consumer group when the transaction
+// is committed, so that messages are consumed and produced exactly once.
+func (m *MockProducer) SendOffsetsToTxn(groupID string, msgs ...kafka.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.inTxn {
+		return kafka.InvalidTransactionState
+	}
+	return m.broker.addTxnOffsets(m.id, m.epoch, groupID, commitOffsets(msgs...))
+}
+
+// CommitTxn commits the transaction, its messages become visible to read_committed readers.
+func (m *MockProducer) CommitTxn() error {
+	return m.endTxn(true)
+}
+
+// AbortTxn aborts the transaction, its messages are never visible to read_committed readers.
+func (m *MockProducer) AbortTxn() error {
+	return m.endTxn(false)
+}
+
+func (m *MockProducer) endTxn(commit bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.inTxn {
+		return kafka.InvalidTransactionState
+	}
+
+	m.inTxn = false
+	return m.broker.endTxn(m.id, m.epoch, commit)
+}
+
+// Close closes the MockProducer, an open transaction is aborted.
+func (m *MockProducer) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return nil
+	}
+	m.closed = true
+
+	if m.inTxn {
+		m.inTxn = false
+		// a fenced producer has nothing to abort
+		if err := m.broker.endTxn(m.id, m.epoch, false); err != nil && !errors.Is(err, kafka.InvalidProducerEpoch) {
+			return err
+		}
+	}
+	return nil
+}
+
+// initProducer assigns a producer id, or bumps the epoch of the producer with the transactionalID
+// and aborts its open transaction.
+func (b *Broker) initProducer(transactionalID string) (int64, int16) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if id, ok := b.transactional[transactionalID]; ok && transactionalID != "" {
+		ps := b.producers[id]
+		if ps.txn != nil {
+			b.completeTxn(id, ps, false)
+		}
+		ps.epoch++
+		ps.sequences = make(map[topicPartition]int32)
+		return id, ps.epoch
+	}
+
+	b.nextProducerID++
+	id := b.nextProducerID
+	b.producers[id] = &producerState{sequences: make(map[topicPartition]int32)}
+	if transactionalID != "" {
+		b.transactional[transactionalID] = id
+	}
+	return id, 0
+}
+
+// producer returns the state of a producer, kafka.InvalidProducerEpoch if it was fenced.
+// The caller must hold b.mu.
+func (b *Broker) producer(id int64, epoch int16) (*producerState, error) {
+	ps, ok := b.producers[id]
+	if !ok {
+		return nil, kafka.InvalidProducerIDMapping
+	}
+	if ps.epoch != epoch {
+		return nil, kafka.InvalidProducerEpoch
+	}
+	return ps, nil
+}
+
+// routeAll returns the partitions of messages, see produce.
+func (b *Broker) routeAll(writerTopic string, balancer kafka.Balancer, msgs []kafka.Message) ([]topicPartition, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	tps := make([]topicPartition, len(msgs))
+	for i, msg := range msgs {
+		if writerTopic != "" && msg.Topic != "" {
+			return nil, errors.New("topic must not be specified for both writer and message")
+		}
+
+		t, partition := b.route(writerTopic, balancer, msg)
+		tps[i] = topicPartition{topic: t.name, partition: partition}
+	}
+	return tps, nil
+}
+
+// nextSequence returns the next sequence number of a producer expected by the broker for a partition,
+// false if the producer was fenced.
+func (b *Broker) nextSequence(id int64, epoch int16, tp topicPartition) (int32, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ps, err := b.producer(id, epoch)
+	if err != nil {
+		return 0, false
+	}
+	return ps.sequences[tp], true
+}
+
+// appendSequenced appends the batches of a producer. Batches already appended are discarded,
+// a batch not following the last batch of its partition fails with kafka.OutOfOrderSequenceNumber.
+//
+// The per-message faults of f index the messages of the batches in order: a batch with a failed message
+// is not appended and the first such error is returned once the other batches are appended, dropped
+// messages are acknowledged but not stored.
+func (b *Broker) appendSequenced(id int64, epoch int16, inTxn bool, batches []*sequencedBatch, f fault) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ps, err := b.producer(id, epoch)
+	if err != nil {
+		return err
+	}
+
+	for _, batch := range batches {
+		if batch.baseSequence > ps.sequences[batch.tp] {
+			return kafka.OutOfOrderSequenceNumber
+		}
+	}
+
+	now := time.Now()
+	var failed error
+	// first is the index of the first message of a batch in the write
+	first := 0
+	for _, batch := range batches {
+		start := first
+		first += len(batch.msgs)
+
+		if batch.baseSequence < ps.sequences[batch.tp] {
+			// a retry of a batch already appended
+			continue
+		}
+		if err := batchError(f, start, len(batch.msgs)); err != nil {
+			if failed == nil {
+				failed = err
+			}
+			continue
+		}
+
+		t := b.topics[batch.tp.topic]
+		p := t.partitions[batch.tp.partition]
+		for i, msg := range batch.msgs {
+			if f.skip(start + i) {
+				continue
+			}
+			msg = b.append(t, batch.tp.partition, msg, now)
+			if inTxn {
+				if _, ok := p.open[id]; !ok {
+					p.open[id] = msg.Offset
+				}
+				ps.txn.offsets[batch.tp] = append(ps.txn.offsets[batch.tp], msg.Offset)
+			}
+		}
+		ps.sequences[batch.tp] = batch.baseSequence + int32(len(batch.msgs))
+	}
+
+	b.notify()
+	return failed
+}
+
+// batchError returns the first error of the n messages of a write starting at index start, if any.
+func batchError(f fault, start, n int) error {
+	if f.errs == nil {
+		return nil
+	}
+	for _, err := range f.errs[start : start+n] {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// beginTxn begins a transaction of a producer.
+func (b *Broker) beginTxn(id int64, epoch int16) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ps, err := b.producer(id, epoch)
+	if err != nil {
+		return err
+	}
+
+	ps.txn = &transaction{
+		offsets:      make(map[topicPartition][]int64),
+		groupOffsets: make(map[string]map[topicPartition]int64),
+	}
+	return nil
+}
+
+// addTxnOffsets adds offsets of a consumer group to the transaction of a producer.
+func (b *Broker) addTxnOffsets(id int64, epoch int16, groupID string, offsets map[topicPartition]int64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ps, err := b.producer(id, epoch)
+	if err != nil {
+		return err
+	}
+
+	pending, ok := ps.txn.groupOffsets[groupID]
+	if !ok {
+		pending = make(map[topicPartition]int64)
+		ps.txn.groupOffsets[groupID] = pending
+	}
+	for tp, offset := range offsets {
+		pending[tp] = max(pending[tp], offset)
+	}
+	return nil
+}
+
+// endTxn commits or aborts the transaction of a producer.
+func (b *Broker) endTxn(id int64, epoch int16, commit bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ps, err := b.producer(id, epoch)
+	if err != nil {
+		return err
+	}
+	if ps.txn == nil {
+		return kafka.InvalidTransactionState
+	}
+
+	b.completeTxn(id, ps, commit)
+	return nil
+}
+
+// completeTxn commits or aborts the open transaction of a producer, the caller must hold b.mu.
+func (b *Broker) completeTxn(id int64, ps *producerState, commit bool) {
+	for tp, offsets := range ps.txn.offsets {
+		p := b.topics[tp.topic].partitions[tp.partition]
+		delete(p.open, id)
+		if !commit {
+			for _, offset := range offsets {
+				p.aborted[offset] = struct{}{}
+			}
+		}
+	}
+
+	if commit {
+		for groupID, offsets := range ps.txn.groupOffsets {
+			b.group(groupID).commit(offsets)
+		}
+	}
+
+	ps.txn = nil
+	b.notify()
+}
@@ -0,0 +1,153 @@
+package kafkamock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMockProducer_Idempotent(t *testing.T) {
+	broker := NewBroker(1)
+	msg := kafka.Message{Value: []byte("payment")}
+
+	// a plain writer retrying a write whose acknowledgement was lost writes a duplicate
+	writer := NewBrokerWriter(broker, &kafka.Writer{Topic: "plain"})
+	broker.LoseAcks(1)
+	assert.ErrorIs(t, writer.WriteMessages(context.Background(), msg), kafka.RequestTimedOut)
+	require.NoError(t, writer.WriteMessages(context.Background(), msg))
+	assert.Len(t, broker.Messages("plain", 0), 2)
+
+	// the retries of an idempotent producer are discarded
+	producer := NewMockProducer(broker, &kafka.Writer{Topic: "payments"}, "")
+	broker.LoseAcks(2)
+	require.NoError(t, producer.WriteMessages(context.Background(), msg, msg))
+	require.NoError(t, producer.WriteMessages(context.Background(), msg))
+	assert.Len(t, broker.Messages("payments", 0), 3)
+
+	broker.FailWrites(1, kafka.NotEnoughReplicas)
+	require.NoError(t, producer.WriteMessages(context.Background(), msg))
+	assert.Len(t, broker.Messages("payments", 0), 4)
+
+	// a write stored once the attempts are exhausted is not discarded as a retry by the next write
+	producer = NewMockProducer(broker, &kafka.Writer{Topic: "refunds", MaxAttempts: 1}, "")
+	broker.LoseAcks(1)
+	assert.ErrorIs(t, producer.WriteMessages(context.Background(), kafka.Message{Value: []byte("a")}), kafka.RequestTimedOut)
+	require.NoError(t, producer.WriteMessages(context.Background(), kafka.Message{Value: []byte("b")}))
+	refunds := broker.Messages("refunds", 0)
+	if assert.Len(t, refunds, 2) {
+		assert.Equal(t, "a", string(refunds[0].Value))
+		assert.Equal(t, "b", string(refunds[1].Value))
+	}
+	assert.ErrorIs(t, producer.BeginTxn(), errNotTransactional)
+}
+
+func TestMockProducer_MessageFaults(t *testing.T) {
+	broker := NewBroker(1)
+	msg := kafka.Message{Value: []byte("payment")}
+
+	// a failed partition is retried, the retry is written once
+	producer := NewMockProducer(broker, &kafka.Writer{Topic: "payments"}, "")
+	broker.FailPartialWrites(1, 1, kafka.NotEnoughReplicas)
+	require.NoError(t, producer.WriteMessages(context.Background(), msg, msg))
+	assert.Len(t, broker.Messages("payments", 0), 2)
+
+	producer = NewMockProducer(broker, &kafka.Writer{Topic: "payments", MaxAttempts: 1}, "")
+	broker.FailPartialWrites(1, 1, kafka.NotEnoughReplicas)
+	assert.ErrorIs(t, producer.WriteMessages(context.Background(), msg), kafka.NotEnoughReplicas)
+	assert.Len(t, broker.Messages("payments", 0), 2)
+
+	// dropped messages are acknowledged, the next write follows them
+	broker.DropMessages(1)
+	require.NoError(t, producer.WriteMessages(context.Background(), msg))
+	assert.Len(t, broker.Messages("payments", 0), 2)
+
+	broker.ClearFaults()
+	require.NoError(t, producer.WriteMessages(context.Background(), msg))
+	assert.Len(t, broker.Messages("payments", 0), 3)
+}
+
+func TestMockProducer_Transactions(t *testing.T) {
+	broker := NewBroker(1)
+	require.NoError(t, broker.CreateTopic("orders", 1))
+
+	committed := NewBrokerReader(broker, kafka.ReaderConfig{Topic: "orders", IsolationLevel: kafka.ReadCommitted})
+	uncommitted := NewBrokerReader(broker, kafka.ReaderConfig{Topic: "orders"})
+
+	producer := NewMockProducer(broker, &kafka.Writer{Topic: "orders"}, "orders-tx")
+	assert.ErrorIs(t, producer.WriteMessages(context.Background(), kafka.Message{}), kafka.InvalidTransactionState)
+
+	require.NoError(t, producer.BeginTxn())
+	require.NoError(t, producer.WriteMessages(context.Background(), kafka.Message{Value: []byte("aborted")}))
+	require.NoError(t, producer.AbortTxn())
+
+	require.NoError(t, producer.BeginTxn())
+	require.NoError(t, producer.WriteMessages(context.Background(), kafka.Message{Value: []byte("o1")}))
+
+	// messages of open transactions are only visible to read_uncommitted readers
+	msg, err := uncommitted.ReadMessage(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []byte("aborted"), msg.Value)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = committed.ReadMessage(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	done := make(chan kafka.Message)
+	go func() {
+		msg, _ := committed.ReadMessage(context.Background())
+		done <- msg
+	}()
+	require.NoError(t, producer.CommitTxn())
+
+	msg = <-done
+	assert.Equal(t, []byte("o1"), msg.Value)
+	assert.Equal(t, int64(1), msg.Offset, "aborted messages are skipped")
+}
+
+func TestMockProducer_ExactlyOnce(t *testing.T) {
+	broker := NewBroker(1)
+	source := NewBrokerWriter(broker, &kafka.Writer{Topic: "orders"})
+	require.NoError(t, source.WriteMessages(context.Background(),
+		kafka.Message{Value: []byte("o1")},
+		kafka.Message{Value: []byte("o2")},
+	))
+
+	reader := NewBrokerReader(broker, kafka.ReaderConfig{Topic: "orders", GroupID: "billing"})
+	defer reader.Close()
+	msg, err := reader.FetchMessage(context.Background())
+	require.NoError(t, err)
+
+	producer := NewMockProducer(broker, &kafka.Writer{Topic: "invoices"}, "billing-0")
+	require.NoError(t, producer.BeginTxn())
+	require.NoError(t, producer.WriteMessages(context.Background(), kafka.Message{Value: []byte("invoice-o1")}))
+	require.NoError(t, producer.SendOffsetsToTxn("billing", msg))
+	assert.Empty(t, broker.CommittedOffsets("billing", "orders"), "offsets are committed with the transaction")
+
+	// a new instance with the same transactional id fences the previous one and aborts its transaction
+	zombie := producer
+	producer = NewMockProducer(broker, &kafka.Writer{Topic: "invoices"}, "billing-0")
+	assert.ErrorIs(t, zombie.CommitTxn(), kafka.InvalidProducerEpoch)
+	assert.Empty(t, broker.CommittedOffsets("billing", "orders"))
+
+	zombieID, zombieEpoch := zombie.ProducerID()
+	id, epoch := producer.ProducerID()
+	assert.Equal(t, zombieID, id)
+	assert.Equal(t, zombieEpoch+1, epoch)
+
+	require.NoError(t, producer.BeginTxn())
+	require.NoError(t, producer.WriteMessages(context.Background(), kafka.Message{Value: []byte("invoice-o1")}))
+	require.NoError(t, producer.SendOffsetsToTxn("billing", msg))
+	require.NoError(t, producer.CommitTxn())
+	assert.Equal(t, map[int]int64{0: 1}, broker.CommittedOffsets("billing", "orders"))
+
+	invoices := NewBrokerReader(broker, kafka.ReaderConfig{Topic: "invoices", IsolationLevel: kafka.ReadCommitted})
+	msg, err = invoices.ReadMessage(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), msg.Offset)
+	assert.Equal(t, int64(0), invoices.Lag())
+}
@@ -0,0 +1,158 @@
+package kafkamock
+
+import (
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// RetentionPolicy is the retention policy of a topic, it is enforced when Clean is called
+// so tests decide when messages are deleted.
+type RetentionPolicy struct {
+	// RetentionTime deletes messages older than it, 0 keeps messages forever.
+	RetentionTime time.Duration
+	// RetentionBytes deletes the oldest messages of a partition larger than it, 0 has no limit.
+	RetentionBytes int64
+
+	// Compact keeps only the last message of each key. A message with a nil value is a tombstone,
+	// it deletes the previous messages of its key.
+	Compact bool
+	// DeleteRetention deletes tombstones older than it when compacting, 0 keeps tombstones.
+	DeleteRetention time.Duration
+}
+
+// SetRetentionPolicy sets the retention policy of the topic.
+func (b *Broker) SetRetentionPolicy(topic string, policy RetentionPolicy) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t, ok := b.topics[topic]
+	if !ok {
+		return kafka.UnknownTopicOrPartition
+	}
+	t.retention = policy
+	return nil
+}
+
+// Clean enforces the retention policy of the topic: it deletes messages by age and size
+// and compacts the partitions of a compacted topic. Offsets of the remaining messages are unchanged.
+func (b *Broker) Clean(topic string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t, ok := b.topics[topic]
+	if !ok {
+		return kafka.UnknownTopicOrPartition
+	}
+
+	now := time.Now()
+	for _, p := range t.partitions {
+		if t.retention.RetentionTime > 0 {
+			p.deleteBefore(now.Add(-t.retention.RetentionTime))
+		}
+		if t.retention.RetentionBytes > 0 {
+			p.deleteOver(t.retention.RetentionBytes)
+		}
+		if t.retention.Compact {
+			p.compact(now, t.retention.DeleteRetention)
+		}
+	}
+
+	return nil
+}
+
+// deleteBefore deletes the messages written before t.
+func (p *partition) deleteBefore(t time.Time) {
+	i := 0
+	for i < len(p.messages) && p.messages[i].Time.Before(t) {
+		i++
+	}
+	p.deleteFirst(i)
+}
+
+// deleteOver deletes the oldest messages until the partition is not larger than size bytes.
+func (p *partition) deleteOver(size int64) {
+	var total int64
+	for _, msg := range p.messages {
+		total += messageSize(msg)
+	}
+
+	i := 0
+	for i < len(p.messages) && total > size {
+		total -= messageSize(p.messages[i])
+		i++
+	}
+	p.deleteFirst(i)
+}
+
+// deleteFirst deletes the first n messages and moves the start offset after them.
+func (p *partition) deleteFirst(n int) {
+	if n == 0 {
+		return
+	}
+
+	p.messages = p.messages[n:]
+	if len(p.messages) > 0 {
+		p.startOffset = p.messages[0].Offset
+	} else {
+		p.startOffset = p.nextOffset
+	}
+}
+
+// compact keeps the last message of each key, tombstones older than deleteRetention are deleted.
+// Messages without a key are kept.
+func (p *partition) compact(now time.Time, deleteRetention time.Duration) {
+	last := make(map[string]int64)
+	for _, msg := range p.messages {
+		if msg.Key != nil {
+			last[string(msg.Key)] = msg.Offset
+		}
+	}
+
+	compacted := p.messages[:0]
+	for _, msg := range p.messages {
+		if msg.Key != nil {
+			if last[string(msg.Key)] != msg.Offset {
+				continue
+			}
+			if msg.Value == nil && deleteRetention > 0 && msg.Time.Before(now.Add(-deleteRetention)) {
+				continue
+			}
+		}
+		compacted = append(compacted, msg)
+	}
+
+	clear(p.messages[len(compacted):])
+	p.messages = compacted
+}
+
+// messageSize returns the size of the key, value and headers of a message.
+func messageSize(msg kafka.Message) int64 {
+	size := len(msg.Key) + len(msg.Value)
+	for _, h := range msg.Headers {
+		size += len(h.Key) + len(h.Value)
+	}
+	return int64(size)
+}
+
+// cloneMessage returns a copy of the message that does not share the key, value and headers,
+// so that the log is not changed if the writer reuses its buffers. A nil value stays nil.
+func cloneMessage(msg kafka.Message) kafka.Message {
+	msg.Key = cloneBytes(msg.Key)
+	msg.Value = cloneBytes(msg.Value)
+	if msg.Headers != nil {
+		headers := make([]kafka.Header, len(msg.Headers))
+		for i, h := range msg.Headers {
+			headers[i] = kafka.Header{Key: h.Key, Value: cloneBytes(h.Value)}
+		}
+		msg.Headers = headers
+	}
+	return msg
+}
+
+func cloneBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
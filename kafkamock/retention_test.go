@@ -0,0 +1,108 @@
+package kafkamock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeadersAndTombstones(t *testing.T) {
+	mockKafka := NewMockKafka(10)
+
+	value := []byte("v1")
+	headers := []kafka.Header{{Key: "trace-id", Value: []byte("abc")}}
+	require.NoError(t, mockKafka.WriteMessages(context.Background(),
+		kafka.Message{Key: []byte("k1"), Value: value, Headers: headers},
+		kafka.Message{Key: []byte("k1"), Value: nil},
+	))
+
+	// the log is not changed when the writer reuses its buffers
+	value[0] = 'x'
+	headers[0].Value[0] = 'x'
+
+	msg, err := mockKafka.ReadMessage(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []byte("v1"), msg.Value)
+	assert.Equal(t, []kafka.Header{{Key: "trace-id", Value: []byte("abc")}}, msg.Headers)
+
+	tombstone, err := mockKafka.ReadMessage(context.Background())
+	require.NoError(t, err)
+	assert.Nil(t, tombstone.Value)
+	assert.Nil(t, tombstone.Headers)
+}
+
+func TestClean_Compaction(t *testing.T) {
+	broker := NewBroker(1)
+	require.NoError(t, broker.CreateTopic("users", 1))
+	require.NoError(t, broker.SetRetentionPolicy("users", RetentionPolicy{Compact: true}))
+
+	writer := NewBrokerWriter(broker, &kafka.Writer{Topic: "users"})
+	require.NoError(t, writer.WriteMessages(context.Background(),
+		kafka.Message{Key: []byte("alice"), Value: []byte("v1")},
+		kafka.Message{Key: []byte("bob"), Value: []byte("v1")},
+		kafka.Message{Key: []byte("alice"), Value: []byte("v2")},
+		kafka.Message{Key: []byte("bob"), Value: nil},
+		kafka.Message{Key: []byte("carol"), Value: []byte("v1")},
+	))
+
+	require.NoError(t, broker.Clean("users"))
+
+	log := broker.Messages("users", 0)
+	require.Len(t, log, 3)
+	assert.Equal(t, int64(2), log[0].Offset, "offsets are kept")
+	assert.Equal(t, int64(3), log[1].Offset)
+	assert.Equal(t, int64(4), log[2].Offset)
+
+	// a consumer rebuilding its state from the compacted topic
+	reader := NewBrokerReader(broker, kafka.ReaderConfig{Topic: "users"})
+	state := make(map[string]string)
+	for range log {
+		msg, err := reader.ReadMessage(context.Background())
+		require.NoError(t, err)
+		if msg.Value == nil {
+			delete(state, string(msg.Key))
+		} else {
+			state[string(msg.Key)] = string(msg.Value)
+		}
+	}
+	assert.Equal(t, map[string]string{"alice": "v2", "carol": "v1"}, state)
+
+	// tombstones are deleted after the delete retention
+	require.NoError(t, broker.SetRetentionPolicy("users", RetentionPolicy{Compact: true, DeleteRetention: time.Nanosecond}))
+	time.Sleep(time.Millisecond)
+	require.NoError(t, broker.Clean("users"))
+	assert.Len(t, broker.Messages("users", 0), 2)
+}
+
+func TestClean_Delete(t *testing.T) {
+	broker := NewBroker(1)
+	require.NoError(t, broker.CreateTopic("logs", 1))
+	require.NoError(t, broker.SetRetentionPolicy("logs", RetentionPolicy{RetentionTime: time.Hour, RetentionBytes: 4}))
+
+	writer := NewBrokerWriter(broker, &kafka.Writer{Topic: "logs"})
+	require.NoError(t, writer.WriteMessages(context.Background(),
+		kafka.Message{Value: []byte("old"), Time: time.Now().Add(-2 * time.Hour)},
+		kafka.Message{Value: []byte("m1")},
+		kafka.Message{Value: []byte("m2")},
+		kafka.Message{Value: []byte("m3")},
+	))
+
+	reader := NewBrokerReader(broker, kafka.ReaderConfig{Topic: "logs"})
+
+	require.NoError(t, broker.Clean("logs"))
+	log := broker.Messages("logs", 0)
+	require.Len(t, log, 2)
+	assert.Equal(t, []byte("m2"), log[0].Value)
+
+	// readers continue from the first message retained
+	msg, err := reader.ReadMessage(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), msg.Offset)
+
+	assert.ErrorIs(t, broker.Clean("missing"), kafka.UnknownTopicOrPartition)
+	assert.ErrorIs(t, broker.SetRetentionPolicy("missing", RetentionPolicy{}), kafka.UnknownTopicOrPartition)
+}
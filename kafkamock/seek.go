@@ -0,0 +1,171 @@
+package kafkamock
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+var errNotAvailableWithGroup = errors.New("unavailable when GroupID is set")
+
+// readerStats are the statistics of a MockReader, counters are reset when a snapshot is taken.
+type readerStats struct {
+	fetches    int64
+	messages   int64
+	bytes      int64
+	rebalances int64
+	timeouts   int64
+	errors     int64
+}
+
+// record records the result of a read.
+func (s *readerStats) record(msg kafka.Message, err error) {
+	s.fetches++
+	switch {
+	case err == nil:
+		s.messages++
+		s.bytes += int64(len(msg.Key) + len(msg.Value))
+	case errors.Is(err, context.DeadlineExceeded):
+		s.timeouts++
+	case !errors.Is(err, io.EOF) && !errors.Is(err, context.Canceled):
+		s.errors++
+	}
+}
+
+// SetOffset sets the offset of the next message read, kafka.FirstOffset and kafka.LastOffset
+// seek to the first message retained and after the last message.
+// It is unavailable with a GroupID and fails with io.ErrClosedPipe once the reader is closed.
+func (m *MockReader) SetOffset(offset int64) error {
+	if m.config.GroupID != "" {
+		return errNotAvailableWithGroup
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return io.ErrClosedPipe
+	}
+
+	first, next, err := m.broker.offsets(m.config.Topic, m.config.Partition)
+	if err != nil {
+		return err
+	}
+
+	switch offset {
+	case kafka.FirstOffset:
+		offset = first
+	case kafka.LastOffset:
+		offset = next
+	}
+
+	m.seek(offset)
+	return nil
+}
+
+// SetOffsetAt sets the offset of the next message read to the first message written at or after t.
+// It is unavailable with a GroupID and fails with io.ErrClosedPipe once the reader is closed.
+func (m *MockReader) SetOffsetAt(ctx context.Context, t time.Time) error {
+	if m.config.GroupID != "" {
+		return errNotAvailableWithGroup
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return io.ErrClosedPipe
+	}
+
+	offset, err := m.broker.offsetAt(m.config.Topic, m.config.Partition, t)
+	if err != nil {
+		return err
+	}
+
+	m.seek(offset)
+	return nil
+}
+
+// seek sets the position of the partition read, the caller must hold m.mu.
+func (m *MockReader) seek(offset int64) {
+	tp := topicPartition{topic: m.config.Topic, partition: m.config.Partition}
+	m.positions[tp] = offset
+
+	// wake up pending reads to read from the new offset
+	m.broker.wake()
+}
+
+// Offset returns the offset of the next message read, -1 with a GroupID.
+func (m *MockReader) Offset() int64 {
+	if m.config.GroupID != "" {
+		return -1
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.positions[topicPartition{topic: m.config.Topic, partition: m.config.Partition}]
+}
+
+// Lag returns the number of messages after the offset of the reader, -1 with a GroupID.
+func (m *MockReader) Lag() int64 {
+	if m.config.GroupID != "" {
+		return -1
+	}
+
+	lag, _ := m.ReadLag(context.Background())
+	return lag
+}
+
+// ReadLag returns the number of messages after the offset of the reader.
+// It is unavailable with a GroupID, see Broker.GroupLag for the lag of a consumer group.
+func (m *MockReader) ReadLag(ctx context.Context) (int64, error) {
+	if m.config.GroupID != "" {
+		return 0, errNotAvailableWithGroup
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, next, err := m.broker.offsets(m.config.Topic, m.config.Partition)
+	if err != nil {
+		return 0, err
+	}
+
+	offset := m.positions[topicPartition{topic: m.config.Topic, partition: m.config.Partition}]
+	return max(next-offset, 0), nil
+}
+
+// Stats returns the statistics of the reader like kafka.Reader.Stats,
+// counters are reset on every call.
+func (m *MockReader) Stats() kafka.ReaderStats {
+	offset, lag := m.Offset(), m.Lag()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.stats
+	m.stats = readerStats{}
+
+	stats := kafka.ReaderStats{
+		Fetches:    s.fetches,
+		Messages:   s.messages,
+		Bytes:      s.bytes,
+		Rebalances: s.rebalances,
+		Timeouts:   s.timeouts,
+		Errors:     s.errors,
+		Offset:     offset,
+		Lag:        lag,
+		MinBytes:   int64(m.config.MinBytes),
+		MaxBytes:   int64(m.config.MaxBytes),
+		MaxWait:    m.config.MaxWait,
+		Topic:      m.config.Topic,
+		Partition:  strconv.Itoa(m.config.Partition),
+	}
+	stats.DeprecatedFetchesWithTypo = stats.Fetches
+	return stats
+}
@@ -0,0 +1,99 @@
+package kafkamock
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMockReader_SetOffset(t *testing.T) {
+	broker := NewBroker(1)
+	writer := NewBrokerWriter(broker, &kafka.Writer{Topic: "events"})
+	for i := 0; i < 5; i++ {
+		require.NoError(t, writer.WriteMessages(context.Background(), kafka.Message{Value: []byte(fmt.Sprintf("e%d", i))}))
+	}
+
+	reader := NewBrokerReader(broker, kafka.ReaderConfig{Topic: "events"})
+	assert.Equal(t, int64(0), reader.Offset())
+	assert.Equal(t, int64(5), reader.Lag())
+
+	require.NoError(t, reader.SetOffset(3))
+	msg, err := reader.ReadMessage(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []byte("e3"), msg.Value)
+	assert.Equal(t, int64(4), reader.Offset())
+	assert.Equal(t, int64(1), reader.Lag())
+
+	require.NoError(t, reader.SetOffset(kafka.FirstOffset))
+	msg, err = reader.ReadMessage(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []byte("e0"), msg.Value)
+
+	require.NoError(t, reader.SetOffset(kafka.LastOffset))
+	lag, err := reader.ReadLag(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), lag)
+
+	require.NoError(t, reader.Close())
+	assert.ErrorIs(t, reader.SetOffset(0), io.ErrClosedPipe)
+
+	group := NewBrokerReader(broker, kafka.ReaderConfig{Topic: "events", GroupID: "replay"})
+	assert.Error(t, group.SetOffset(0))
+	assert.Equal(t, int64(-1), group.Offset())
+	assert.Equal(t, int64(-1), group.Lag())
+}
+
+func TestMockReader_SetOffsetAt(t *testing.T) {
+	broker := NewBroker(1)
+	writer := NewBrokerWriter(broker, &kafka.Writer{Topic: "events"})
+
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		msg := kafka.Message{Value: []byte(fmt.Sprintf("e%d", i)), Time: base.Add(time.Duration(i) * time.Hour)}
+		require.NoError(t, writer.WriteMessages(context.Background(), msg))
+	}
+
+	reader := NewBrokerReader(broker, kafka.ReaderConfig{Topic: "events"})
+	require.NoError(t, reader.SetOffsetAt(context.Background(), base.Add(90*time.Minute)))
+
+	msg, err := reader.ReadMessage(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []byte("e2"), msg.Value)
+
+	require.NoError(t, reader.SetOffsetAt(context.Background(), base.Add(24*time.Hour)))
+	assert.Equal(t, int64(5), reader.Offset(), "seeking after the last message reads new messages only")
+}
+
+func TestMockReader_Stats(t *testing.T) {
+	mockKafka := NewMockKafka(10)
+	require.NoError(t, mockKafka.WriteMessages(context.Background(),
+		kafka.Message{Key: []byte("k"), Value: []byte("value")},
+		kafka.Message{Value: []byte("v2")},
+	))
+
+	_, err := mockKafka.ReadMessage(context.Background())
+	require.NoError(t, err)
+
+	mockKafka.FailReads(1, kafka.RequestTimedOut)
+	_, err = mockKafka.ReadMessage(context.Background())
+	require.Error(t, err)
+
+	stats := mockKafka.MockReader.Stats()
+	assert.Equal(t, int64(2), stats.Fetches)
+	assert.Equal(t, int64(1), stats.Messages)
+	assert.Equal(t, int64(6), stats.Bytes)
+	assert.Equal(t, int64(1), stats.Errors)
+	assert.Equal(t, int64(1), stats.Offset)
+	assert.Equal(t, int64(1), stats.Lag)
+	assert.Equal(t, DefaultTopic, stats.Topic)
+	assert.Equal(t, "0", stats.Partition)
+
+	stats = mockKafka.MockReader.Stats()
+	assert.Equal(t, int64(0), stats.Messages, "counters are reset on snapshot")
+}
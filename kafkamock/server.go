@@ -0,0 +1,675 @@
+package kafkamock
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/protocol"
+	"github.com/segmentio/kafka-go/protocol/apiversions"
+	"github.com/segmentio/kafka-go/protocol/fetch"
+	"github.com/segmentio/kafka-go/protocol/findcoordinator"
+	"github.com/segmentio/kafka-go/protocol/heartbeat"
+	"github.com/segmentio/kafka-go/protocol/joingroup"
+	"github.com/segmentio/kafka-go/protocol/leavegroup"
+	"github.com/segmentio/kafka-go/protocol/listoffsets"
+	"github.com/segmentio/kafka-go/protocol/metadata"
+	"github.com/segmentio/kafka-go/protocol/offsetcommit"
+	"github.com/segmentio/kafka-go/protocol/offsetfetch"
+	"github.com/segmentio/kafka-go/protocol/produce"
+	"github.com/segmentio/kafka-go/protocol/syncgroup"
+)
+
+// serverNodeID is the node id of the fake broker, it is the leader of every partition.
+const serverNodeID = 1
+
+// serverVersions are the api versions supported by the fake broker.
+var serverVersions = []apiversions.ApiKeyResponse{
+	{ApiKey: int16(protocol.Produce), MinVersion: 3, MaxVersion: 8},
+	{ApiKey: int16(protocol.Fetch), MinVersion: 4, MaxVersion: 11},
+	{ApiKey: int16(protocol.ListOffsets), MinVersion: 1, MaxVersion: 5},
+	{ApiKey: int16(protocol.Metadata), MinVersion: 1, MaxVersion: 8},
+	{ApiKey: int16(protocol.OffsetCommit), MinVersion: 2, MaxVersion: 7},
+	{ApiKey: int16(protocol.OffsetFetch), MinVersion: 1, MaxVersion: 5},
+	{ApiKey: int16(protocol.FindCoordinator), MinVersion: 0, MaxVersion: 2},
+	{ApiKey: int16(protocol.JoinGroup), MinVersion: 1, MaxVersion: 5},
+	{ApiKey: int16(protocol.Heartbeat), MinVersion: 0, MaxVersion: 3},
+	{ApiKey: int16(protocol.LeaveGroup), MinVersion: 0, MaxVersion: 2},
+	{ApiKey: int16(protocol.SyncGroup), MinVersion: 0, MaxVersion: 3},
+	{ApiKey: int16(protocol.ApiVersions), MinVersion: 0, MaxVersion: 2},
+}
+
+// Server is a fake kafka broker listening on a loopback TCP port. It speaks the subset of the kafka
+// protocol used by kafka-go: Metadata, Produce, Fetch, ListOffsets, OffsetCommit, OffsetFetch and
+// group coordination, and is backed by a Broker, so unmodified clients such as kafka.Writer,
+// kafka.Reader and kafka.Dial can be tested offline.
+//
+// Write errors and latency of the broker apply to Produce requests, read errors and latency to Fetch requests.
+type Server struct {
+	broker   *Broker
+	listener net.Listener
+	host     string
+	port     int32
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	conns  map[net.Conn]struct{}
+	groups map[string]*wireGroup
+	seq    int
+	closed bool
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewServer starts a fake kafka broker backed by broker on a random loopback port.
+func NewServer(broker *Broker) (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	addr := listener.Addr().(*net.TCPAddr)
+	s := &Server{
+		broker:   broker,
+		listener: listener,
+		host:     addr.IP.String(),
+		port:     int32(addr.Port),
+		conns:    make(map[net.Conn]struct{}),
+		groups:   make(map[string]*wireGroup),
+		done:     make(chan struct{}),
+	}
+	s.cond = sync.NewCond(&s.mu)
+
+	s.wg.Add(1)
+	go s.accept()
+
+	return s, nil
+}
+
+// Addr returns the address of the server, to be used as the broker address of kafka clients.
+func (s *Server) Addr() string {
+	return net.JoinHostPort(s.host, strconv.Itoa(int(s.port)))
+}
+
+// Close stops the server and closes all client connections.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.cond.Broadcast()
+	s.mu.Unlock()
+
+	err := s.listener.Close()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) accept() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.serve(conn)
+	}
+}
+
+// serve handles the requests of a connection in order until it is closed or a request can not be handled.
+func (s *Server) serve(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	for {
+		version, correlationID, clientID, msg, err := protocol.ReadRequest(conn)
+		if err != nil {
+			return
+		}
+
+		var res protocol.Message
+		switch req := msg.(type) {
+		case *apiversions.Request:
+			res = &apiversions.Response{ApiKeys: serverVersions}
+		case *metadata.Request:
+			res = s.metadata(version, req)
+		case *produce.Request:
+			res = s.produce(req)
+			if req.Acks == 0 {
+				// no response is expected without acknowledgement
+				continue
+			}
+		case *fetch.Request:
+			if err := writeRawResponse(conn, correlationID, s.fetch(version, req)); err != nil {
+				return
+			}
+			continue
+		case *listoffsets.Request:
+			res = s.listOffsets(req)
+		case *findcoordinator.Request:
+			res = &findcoordinator.Response{NodeID: serverNodeID, Host: s.host, Port: s.port}
+		case *joingroup.Request:
+			res = s.joinGroup(clientID, req)
+		case *syncgroup.Request:
+			res = s.syncGroup(req)
+		case *heartbeat.Request:
+			res = s.heartbeat(req)
+		case *leavegroup.Request:
+			res = s.leaveGroup(req)
+		case *offsetcommit.Request:
+			res = s.offsetCommit(req)
+		case *offsetfetch.Request:
+			res = s.offsetFetch(req)
+		default:
+			return
+		}
+
+		if err := protocol.WriteResponse(conn, version, correlationID, res); err != nil {
+			return
+		}
+	}
+}
+
+// metadata describes the requested topics, all topics if none is requested.
+// Missing topics are created as with auto.create.topics.enable, unless a v4+ request disallows it.
+func (s *Server) metadata(version int16, req *metadata.Request) *metadata.Response {
+	res := &metadata.Response{
+		Brokers:      []metadata.ResponseBroker{{NodeID: serverNodeID, Host: s.host, Port: s.port}},
+		ClusterID:    "kafkamock",
+		ControllerID: serverNodeID,
+	}
+
+	names := req.TopicNames
+	if len(names) == 0 {
+		names = s.broker.Topics()
+	}
+
+	autoCreate := version < 4 || req.AllowAutoTopicCreation
+	for _, name := range names {
+		partitions := s.broker.partitionsOf(name, autoCreate)
+		if partitions == 0 {
+			res.Topics = append(res.Topics, metadata.ResponseTopic{
+				ErrorCode: int16(kafka.UnknownTopicOrPartition),
+				Name:      name,
+			})
+			continue
+		}
+
+		topic := metadata.ResponseTopic{Name: name}
+		for i := range partitions {
+			topic.Partitions = append(topic.Partitions, metadata.ResponsePartition{
+				PartitionIndex: int32(i),
+				LeaderID:       serverNodeID,
+				ReplicaNodes:   []int32{serverNodeID},
+				IsrNodes:       []int32{serverNodeID},
+			})
+		}
+		res.Topics = append(res.Topics, topic)
+	}
+
+	return res
+}
+
+// produce appends the records of the request to the partitions of the broker.
+// Faults are injected as for a write of all the records of the request: dropped records are not stored,
+// and a partition with a failed record fails as a whole, as its record batch is appended atomically.
+func (s *Server) produce(req *produce.Request) *produce.Response {
+	res := &produce.Response{}
+
+	records := make([][]recordSet, len(req.Topics))
+	n := 0
+	for i, t := range req.Topics {
+		records[i] = make([]recordSet, len(t.Partitions))
+		for j, p := range t.Partitions {
+			msgs, err := readRecords(p.RecordSet.Records)
+			records[i][j] = recordSet{msgs: msgs, err: err}
+			n += len(msgs)
+		}
+	}
+
+	f := s.broker.writeFault(n)
+	if f.latency > 0 {
+		sleep(context.Background(), s.done, f.latency)
+	}
+
+	// first is the index of the first record of a partition in the write
+	first := 0
+	for i, t := range req.Topics {
+		topic := produce.ResponseTopic{Topic: t.Topic}
+
+		for j, p := range t.Partitions {
+			partition := produce.ResponsePartition{Partition: p.Partition, LogAppendTime: -1}
+
+			msgs, err := records[i][j].msgs, records[i][j].err
+			if err == nil {
+				err = f.err
+			}
+			for k := range msgs {
+				if err == nil && f.errs != nil {
+					err = f.errs[first+k]
+				}
+			}
+			if err == nil {
+				var kept []kafka.Message
+				for k, msg := range msgs {
+					if !f.skip(first + k) {
+						kept = append(kept, msg)
+					}
+				}
+
+				var written []kafka.Message
+				written, err = s.broker.appendBatch(topicPartition{topic: t.Topic, partition: int(p.Partition)}, kept)
+				if err == nil {
+					var next int64
+					partition.LogStartOffset, next, _ = s.broker.offsets(t.Topic, int(p.Partition))
+					partition.BaseOffset = next - int64(len(written))
+				}
+			}
+			if err == nil {
+				err = f.ackErr
+			}
+			partition.ErrorCode = errorCode(err)
+			first += len(msgs)
+
+			topic.Partitions = append(topic.Partitions, partition)
+		}
+
+		res.Topics = append(res.Topics, topic)
+	}
+
+	return res
+}
+
+// recordSet are the records of a partition of a produce request, or the error decoding them.
+type recordSet struct {
+	msgs []kafka.Message
+	err  error
+}
+
+// fetch returns the encoded response of a fetch request, waiting up to the max wait time of the request
+// for messages to be available.
+func (s *Server) fetch(version int16, req *fetch.Request) []byte {
+	f := s.broker.readFault()
+	deadline := time.Now().Add(max(time.Duration(req.MaxWaitTime)*time.Millisecond, f.latency))
+	if f.latency > 0 {
+		sleep(context.Background(), s.done, f.latency)
+	}
+
+	for {
+		changed := s.broker.wait()
+
+		var partitions [][]fetchPartition
+		available := false
+		for _, t := range req.Topics {
+			var fps []fetchPartition
+			for _, p := range t.Partitions {
+				fp := fetchPartition{err: f.err}
+				if f.err == nil {
+					fp = s.broker.fetchFrom(t.Topic, int(p.Partition), p.FetchOffset, int(p.PartitionMaxBytes),
+						kafka.IsolationLevel(req.IsolationLevel))
+				}
+				fp.index = p.Partition
+				available = available || len(fp.messages) > 0 || fp.err != nil
+				fps = append(fps, fp)
+			}
+			partitions = append(partitions, fps)
+		}
+
+		wait := time.Until(deadline)
+		if available || wait <= 0 {
+			return encodeFetchResponse(version, req, partitions)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-changed:
+		case <-timer.C:
+		case <-s.done:
+		}
+		timer.Stop()
+	}
+}
+
+// listOffsets returns the first or last offset of the requested partitions,
+// or the offset of the first message at or after a timestamp.
+func (s *Server) listOffsets(req *listoffsets.Request) *listoffsets.Response {
+	res := &listoffsets.Response{}
+
+	for _, t := range req.Topics {
+		topic := listoffsets.ResponseTopic{Topic: t.Topic}
+
+		for _, p := range t.Partitions {
+			partition := listoffsets.ResponsePartition{Partition: p.Partition, Timestamp: -1}
+
+			first, next, err := s.broker.offsets(t.Topic, int(p.Partition))
+			if err == nil && s.broker.Partitions(t.Topic) == 0 {
+				err = kafka.UnknownTopicOrPartition
+			}
+
+			switch {
+			case err != nil:
+				partition.ErrorCode = errorCode(err)
+			case p.Timestamp == kafka.FirstOffset:
+				partition.Offset = first
+			case p.Timestamp == kafka.LastOffset:
+				partition.Offset = next
+			default:
+				partition.Offset, partition.Timestamp = s.broker.offsetAtTime(t.Topic, int(p.Partition), time.UnixMilli(p.Timestamp))
+			}
+
+			topic.Partitions = append(topic.Partitions, partition)
+		}
+
+		res.Topics = append(res.Topics, topic)
+	}
+
+	return res
+}
+
+// offsetCommit commits the offsets of a consumer group, they are shared with the MockReaders of the group.
+func (s *Server) offsetCommit(req *offsetcommit.Request) *offsetcommit.Response {
+	res := &offsetcommit.Response{}
+	offsets := make(map[topicPartition]int64)
+
+	for _, t := range req.Topics {
+		topic := offsetcommit.ResponseTopic{Name: t.Name}
+		for _, p := range t.Partitions {
+			offsets[topicPartition{topic: t.Name, partition: int(p.PartitionIndex)}] = p.CommittedOffset
+			topic.Partitions = append(topic.Partitions, offsetcommit.ResponsePartition{PartitionIndex: p.PartitionIndex})
+		}
+		res.Topics = append(res.Topics, topic)
+	}
+
+	s.broker.commit(req.GroupID, offsets)
+	return res
+}
+
+// offsetFetch returns the offsets committed by a consumer group, -1 for partitions without a committed offset.
+func (s *Server) offsetFetch(req *offsetfetch.Request) *offsetfetch.Response {
+	res := &offsetfetch.Response{}
+
+	for _, t := range req.Topics {
+		committed := s.broker.CommittedOffsets(req.GroupID, t.Name)
+
+		topic := offsetfetch.ResponseTopic{Name: t.Name}
+		for _, index := range t.PartitionIndexes {
+			offset, ok := committed[int(index)]
+			if !ok {
+				offset = -1
+			}
+			topic.Partitions = append(topic.Partitions, offsetfetch.ResponsePartition{
+				PartitionIndex:  index,
+				CommittedOffset: offset,
+			})
+		}
+		res.Topics = append(res.Topics, topic)
+	}
+
+	return res
+}
+
+// fetchPartition is the result of fetching a partition.
+type fetchPartition struct {
+	index         int32
+	messages      []kafka.Message
+	highWatermark int64
+	lastStable    int64
+	startOffset   int64
+	err           error
+}
+
+// encodeFetchResponse encodes the body of a fetch response. Record batches are encoded here because
+// protocol.RecordSet numbers records from 0, while fetched messages keep their offsets.
+func encodeFetchResponse(version int16, req *fetch.Request, partitions [][]fetchPartition) []byte {
+	var e wireEncoder
+
+	e.int32(0) // throttle time
+	if version >= 7 {
+		e.int16(0) // error code
+		e.int32(req.SessionID)
+	}
+
+	e.int32(int32(len(req.Topics)))
+	for i, t := range req.Topics {
+		e.string(t.Topic)
+		e.int32(int32(len(partitions[i])))
+
+		for _, p := range partitions[i] {
+			e.int32(p.index)
+			e.int16(errorCode(p.err))
+			e.int64(p.highWatermark)
+			e.int64(p.lastStable)
+			if version >= 5 {
+				e.int64(p.startOffset)
+			}
+			e.int32(-1) // aborted transactions
+			if version >= 11 {
+				e.int32(-1) // preferred read replica
+			}
+
+			var records bytes.Buffer
+			for _, msg := range p.messages {
+				records.Write(encodeRecordBatch(msg))
+			}
+			e.bytes(records.Bytes())
+		}
+	}
+
+	return e.Bytes()
+}
+
+// encodeRecordBatch encodes a message as a record batch holding a single record at the offset of the message.
+func encodeRecordBatch(msg kafka.Message) []byte {
+	headers := make([]protocol.Header, len(msg.Headers))
+	for i, h := range msg.Headers {
+		headers[i] = protocol.Header{Key: h.Key, Value: h.Value}
+	}
+
+	rs := protocol.RecordSet{
+		Version: 2,
+		Records: protocol.NewRecordReader(protocol.Record{
+			Time:    msg.Time,
+			Key:     protocol.NewBytes(msg.Key),
+			Value:   protocol.NewBytes(msg.Value),
+			Headers: headers,
+		}),
+	}
+
+	var buf bytes.Buffer
+	if _, err := rs.WriteTo(&buf); err != nil {
+		return nil
+	}
+
+	// skip the size of the record set, the base offset is not covered by the checksum of the batch
+	batch := buf.Bytes()[4:]
+	binary.BigEndian.PutUint64(batch[:8], uint64(msg.Offset))
+	return batch
+}
+
+// writeRawResponse writes a response with an encoded body.
+func writeRawResponse(w io.Writer, correlationID int32, body []byte) error {
+	var e wireEncoder
+	e.int32(int32(4 + len(body)))
+	e.int32(correlationID)
+	e.Write(body)
+
+	_, err := w.Write(e.Bytes())
+	return err
+}
+
+// wireEncoder encodes the primitive types of the kafka protocol.
+type wireEncoder struct {
+	bytes.Buffer
+}
+
+func (e *wireEncoder) int16(v int16) {
+	e.Write(binary.BigEndian.AppendUint16(nil, uint16(v)))
+}
+
+func (e *wireEncoder) int32(v int32) {
+	e.Write(binary.BigEndian.AppendUint32(nil, uint32(v)))
+}
+
+func (e *wireEncoder) int64(v int64) {
+	e.Write(binary.BigEndian.AppendUint64(nil, uint64(v)))
+}
+
+func (e *wireEncoder) string(s string) {
+	e.int16(int16(len(s)))
+	e.WriteString(s)
+}
+
+func (e *wireEncoder) bytes(b []byte) {
+	e.int32(int32(len(b)))
+	e.Write(b)
+}
+
+// readRecords reads the records of a produce request as messages.
+func readRecords(records protocol.RecordReader) ([]kafka.Message, error) {
+	if records == nil {
+		return nil, nil
+	}
+
+	var msgs []kafka.Message
+	for {
+		r, err := records.ReadRecord()
+		if errors.Is(err, io.EOF) {
+			return msgs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		msg := kafka.Message{Time: r.Time}
+		if msg.Key, err = protocol.ReadAll(r.Key); err != nil {
+			return nil, err
+		}
+		if msg.Value, err = protocol.ReadAll(r.Value); err != nil {
+			return nil, err
+		}
+		for _, h := range r.Headers {
+			msg.Headers = append(msg.Headers, kafka.Header{Key: h.Key, Value: h.Value})
+		}
+
+		msgs = append(msgs, msg)
+	}
+}
+
+// errorCode returns the kafka error code of err, kafka.Unknown if err is not a kafka error.
+func errorCode(err error) int16 {
+	if err == nil {
+		return 0
+	}
+
+	var kerr kafka.Error
+	if errors.As(err, &kerr) {
+		return int16(kerr)
+	}
+	return int16(kafka.Unknown)
+}
+
+// partitionsOf returns the number of partitions of a topic, creating the topic with the default
+// number of partitions if create is true.
+func (b *Broker) partitionsOf(name string, create bool) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t, ok := b.topics[name]
+	if !ok {
+		if !create {
+			return 0
+		}
+		t = b.createTopic(name, b.partitions)
+	}
+	return len(t.partitions)
+}
+
+// fetchFrom returns the messages of a partition visible with the isolation level from offset up to maxBytes,
+// at least one message if any is available.
+func (b *Broker) fetchFrom(name string, partition int, offset int64, maxBytes int, isolation kafka.IsolationLevel) fetchPartition {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t, ok := b.topics[name]
+	if !ok || partition < 0 || partition >= len(t.partitions) {
+		return fetchPartition{err: kafka.UnknownTopicOrPartition}
+	}
+
+	p := t.partitions[partition]
+	fp := fetchPartition{highWatermark: p.nextOffset, lastStable: p.lastStable(), startOffset: p.startOffset}
+	if offset < p.startOffset || offset > p.nextOffset {
+		fp.err = kafka.OffsetOutOfRange
+		return fp
+	}
+
+	size := 0
+	for _, msg := range p.messages {
+		if msg.Offset < offset {
+			continue
+		}
+		if isolation == kafka.ReadCommitted {
+			if msg.Offset >= fp.lastStable {
+				break
+			}
+			if _, ok := p.aborted[msg.Offset]; ok {
+				continue
+			}
+		}
+
+		size += int(messageSize(msg))
+		if len(fp.messages) > 0 && size > maxBytes {
+			break
+		}
+		fp.messages = append(fp.messages, msg)
+	}
+
+	return fp
+}
+
+// offsetAtTime returns the offset and time of the first message of a partition written at or after t,
+// -1 and -1 if there is none.
+func (b *Broker) offsetAtTime(name string, partition int, t time.Time) (int64, int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	p, _ := b.partition(name, partition)
+	if p == nil {
+		return -1, -1
+	}
+	for _, msg := range p.messages {
+		if !msg.Time.Before(t) {
+			return msg.Offset, msg.Time.UnixMilli()
+		}
+	}
+	return -1, -1
+}
@@ -0,0 +1,233 @@
+package kafkamock
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/protocol/heartbeat"
+	"github.com/segmentio/kafka-go/protocol/joingroup"
+	"github.com/segmentio/kafka-go/protocol/leavegroup"
+	"github.com/segmentio/kafka-go/protocol/syncgroup"
+)
+
+// wireGroup is the coordinator state of a consumer group of kafka clients, guarded by Server.mu.
+// Partitions are assigned by the leader of the group as with a real broker, committed offsets are
+// kept by the Broker.
+type wireGroup struct {
+	generation int32
+	members    map[string]joingroup.RequestProtocol
+
+	// joining are the members which joined the current rebalance, nil if the group is stable.
+	// The rebalance completes when all members joined or at the deadline, dropping the others.
+	joining  map[string]joingroup.RequestProtocol
+	deadline time.Time
+	// timeout is the rebalance timeout of the last member which joined.
+	timeout time.Duration
+	// round is incremented when a rebalance completes.
+	round int
+
+	leader      string
+	protocol    string
+	assignments map[string][]byte
+}
+
+// group returns the coordinator state of a group, the caller must hold s.mu.
+func (s *Server) group(groupID string) *wireGroup {
+	g, ok := s.groups[groupID]
+	if !ok {
+		g = &wireGroup{members: make(map[string]joingroup.RequestProtocol)}
+		s.groups[groupID] = g
+	}
+	return g
+}
+
+// rebalance starts a rebalance of the group if none is in progress, the caller must hold s.mu.
+func (s *Server) rebalance(g *wireGroup) {
+	if g.joining != nil {
+		return
+	}
+
+	g.joining = make(map[string]joingroup.RequestProtocol)
+	g.deadline = time.Now().Add(g.timeout)
+	time.AfterFunc(g.timeout, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.cond.Broadcast()
+	})
+}
+
+// complete completes the rebalance of the group if all members joined or the deadline passed,
+// the caller must hold s.mu.
+func (s *Server) complete(g *wireGroup) {
+	if g.joining == nil {
+		return
+	}
+	for id := range g.members {
+		if _, ok := g.joining[id]; !ok && time.Now().Before(g.deadline) {
+			return
+		}
+	}
+
+	g.generation++
+	g.members = g.joining
+	g.joining = nil
+	g.round++
+	g.assignments = nil
+
+	if _, ok := g.members[g.leader]; !ok {
+		g.leader = ""
+		for id := range g.members {
+			if g.leader == "" || id < g.leader {
+				g.leader = id
+			}
+		}
+	}
+	g.protocol = g.members[g.leader].Name
+
+	s.cond.Broadcast()
+}
+
+// joinGroup joins a member to a group and waits for the rebalance to complete.
+// The leader receives the members of the group to assign their partitions.
+func (s *Server) joinGroup(clientID string, req *joingroup.Request) *joingroup.Response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g := s.group(req.GroupID)
+
+	id := req.MemberID
+	if id == "" {
+		s.seq++
+		id = fmt.Sprintf("%s-%d", clientID, s.seq)
+	} else if _, ok := g.members[id]; !ok {
+		return &joingroup.Response{ErrorCode: int16(kafka.UnknownMemberId)}
+	}
+	if len(req.Protocols) == 0 {
+		return &joingroup.Response{ErrorCode: int16(kafka.InconsistentGroupProtocol)}
+	}
+
+	g.timeout = time.Duration(req.RebalanceTimeoutMS) * time.Millisecond
+	s.rebalance(g)
+	g.joining[id] = req.Protocols[0]
+
+	round := g.round
+	for g.round == round && !s.closed {
+		s.complete(g)
+		if g.round == round {
+			s.cond.Wait()
+		}
+	}
+	if s.closed {
+		return &joingroup.Response{ErrorCode: int16(kafka.GroupCoordinatorNotAvailable)}
+	}
+	if _, ok := g.members[id]; !ok {
+		return &joingroup.Response{ErrorCode: int16(kafka.UnknownMemberId)}
+	}
+
+	res := &joingroup.Response{
+		GenerationID: g.generation,
+		ProtocolName: g.protocol,
+		LeaderID:     g.leader,
+		MemberID:     id,
+	}
+	if id == g.leader {
+		ids := make([]string, 0, len(g.members))
+		for id := range g.members {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+
+		for _, id := range ids {
+			res.Members = append(res.Members, joingroup.ResponseMember{MemberID: id, Metadata: g.members[id].Metadata})
+		}
+	}
+	return res
+}
+
+// syncGroup stores the assignments sent by the leader and returns the assignment of the member,
+// followers wait for the leader.
+func (s *Server) syncGroup(req *syncgroup.Request) *syncgroup.Response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g := s.group(req.GroupID)
+	if code := g.check(req.MemberID, req.GenerationID); code != 0 {
+		return &syncgroup.Response{ErrorCode: code}
+	}
+
+	if req.MemberID == g.leader {
+		g.assignments = make(map[string][]byte)
+		for _, a := range req.Assignments {
+			g.assignments[a.MemberID] = a.Assignment
+		}
+		s.cond.Broadcast()
+	}
+
+	round := g.round
+	for g.assignments == nil && g.round == round && g.joining == nil && !s.closed {
+		s.cond.Wait()
+	}
+	if g.assignments == nil || g.round != round {
+		return &syncgroup.Response{ErrorCode: int16(kafka.RebalanceInProgress)}
+	}
+
+	return &syncgroup.Response{ProtocolName: g.protocol, Assignments: g.assignments[req.MemberID]}
+}
+
+// heartbeat tells a member whether it has to rejoin the group.
+func (s *Server) heartbeat(req *heartbeat.Request) *heartbeat.Response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return &heartbeat.Response{ErrorCode: s.group(req.GroupID).check(req.MemberID, req.GenerationID)}
+}
+
+// leaveGroup removes members from a group and rebalances the remaining members.
+func (s *Server) leaveGroup(req *leavegroup.Request) *leavegroup.Response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g := s.group(req.GroupID)
+
+	ids := []string{req.MemberID}
+	for _, m := range req.Members {
+		ids = append(ids, m.MemberID)
+	}
+
+	res := &leavegroup.Response{}
+	for _, id := range ids {
+		if id == "" {
+			continue
+		}
+		if _, ok := g.members[id]; !ok {
+			res.ErrorCode = int16(kafka.UnknownMemberId)
+			continue
+		}
+		delete(g.members, id)
+		delete(g.joining, id)
+	}
+
+	if len(g.members) > 0 {
+		s.rebalance(g)
+	}
+	s.cond.Broadcast()
+
+	return res
+}
+
+// check returns the error code of a request of a member in a generation of the group.
+func (g *wireGroup) check(memberID string, generation int32) int16 {
+	_, ok := g.members[memberID]
+	switch {
+	case !ok:
+		return int16(kafka.UnknownMemberId)
+	case g.joining != nil:
+		return int16(kafka.RebalanceInProgress)
+	case generation != g.generation:
+		return int16(kafka.IllegalGeneration)
+	default:
+		return 0
+	}
+}
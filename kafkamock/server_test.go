@@ -0,0 +1,234 @@
+package kafkamock
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestServer(t *testing.T, broker *Broker) *Server {
+	t.Helper()
+
+	server, err := NewServer(broker)
+	require.NoError(t, err)
+	t.Cleanup(func() { server.Close() })
+	return server
+}
+
+func TestServer_WriterAndReader(t *testing.T) {
+	broker := NewBroker(2)
+	server := newTestServer(t, broker)
+
+	writer := &kafka.Writer{
+		Addr:                   kafka.TCP(server.Addr()),
+		Topic:                  "orders",
+		Balancer:               &kafka.Hash{},
+		BatchTimeout:           time.Millisecond,
+		AllowAutoTopicCreation: true,
+		RequiredAcks:           kafka.RequireAll,
+	}
+	defer writer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var msgs []kafka.Message
+	for i := 0; i < 10; i++ {
+		msgs = append(msgs, kafka.Message{
+			Key:     []byte(fmt.Sprintf("customer-%d", i%3)),
+			Value:   []byte(fmt.Sprintf("order-%d", i)),
+			Headers: []kafka.Header{{Key: "seq", Value: []byte{byte(i)}}},
+		})
+	}
+	require.NoError(t, writer.WriteMessages(ctx, msgs...))
+
+	assert.Equal(t, []string{"orders"}, broker.Topics())
+	assert.Equal(t, 10, len(broker.Messages("orders", 0))+len(broker.Messages("orders", 1)))
+
+	// a partition reader starting after the first message
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   []string{server.Addr()},
+		Topic:     "orders",
+		Partition: 1,
+		MaxWait:   10 * time.Millisecond,
+	})
+	defer reader.Close()
+
+	log := broker.Messages("orders", 1)
+	require.GreaterOrEqual(t, len(log), 2)
+	require.NoError(t, reader.SetOffset(1))
+
+	for _, want := range log[1:] {
+		msg, err := reader.ReadMessage(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, want.Offset, msg.Offset)
+		assert.Equal(t, want.Key, msg.Key)
+		assert.Equal(t, want.Value, msg.Value)
+		assert.Equal(t, want.Headers, msg.Headers)
+	}
+
+	// the reader blocks until a new message is written to its partition
+	done := make(chan kafka.Message)
+	go func() {
+		msg, _ := reader.ReadMessage(ctx)
+		done <- msg
+	}()
+	require.NoError(t, NewBrokerWriter(broker, &kafka.Writer{Topic: "orders", Balancer: partitionBalancer(1)}).
+		WriteMessages(ctx, kafka.Message{Value: []byte("late")}))
+	assert.Equal(t, []byte("late"), (<-done).Value)
+}
+
+func TestServer_ConsumerGroup(t *testing.T) {
+	broker := NewBroker(4)
+	server := newTestServer(t, broker)
+	require.NoError(t, broker.CreateTopic("orders", 4))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	writer := &kafka.Writer{Addr: kafka.TCP(server.Addr()), Topic: "orders", RequiredAcks: kafka.RequireAll, BatchTimeout: time.Millisecond}
+	defer writer.Close()
+
+	for i := 0; i < 20; i++ {
+		require.NoError(t, writer.WriteMessages(ctx, kafka.Message{Key: []byte(fmt.Sprintf("k%d", i)), Value: []byte("v")}))
+	}
+
+	newReader := func() *kafka.Reader {
+		return kafka.NewReader(kafka.ReaderConfig{
+			Brokers:           []string{server.Addr()},
+			GroupID:           "billing",
+			Topic:             "orders",
+			MaxWait:           10 * time.Millisecond,
+			HeartbeatInterval: 50 * time.Millisecond,
+			RebalanceTimeout:  time.Second,
+			StartOffset:       kafka.FirstOffset,
+		})
+	}
+
+	reader := newReader()
+	for i := 0; i < 10; i++ {
+		_, err := reader.ReadMessage(ctx)
+		require.NoError(t, err)
+	}
+	require.NoError(t, reader.Close())
+
+	var committed int64
+	for _, offset := range broker.CommittedOffsets("billing", "orders") {
+		committed += offset
+	}
+	assert.Equal(t, int64(10), committed, "offsets are committed to the broker")
+
+	// a new member continues from the committed offsets
+	reader = newReader()
+	defer reader.Close()
+	for i := 0; i < 10; i++ {
+		_, err := reader.ReadMessage(ctx)
+		require.NoError(t, err)
+	}
+
+	for _, lag := range broker.GroupLag("billing", "orders") {
+		assert.Equal(t, int64(0), lag)
+	}
+}
+
+func TestServer_Conn(t *testing.T) {
+	broker := NewBroker(1)
+	server := newTestServer(t, broker)
+	require.NoError(t, broker.CreateTopic("orders", 1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	conn, err := kafka.DialLeader(ctx, "tcp", server.Addr(), "orders", 0)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.WriteMessages(kafka.Message{Value: []byte("m1")}, kafka.Message{Value: []byte("m2")})
+	require.NoError(t, err)
+
+	first, last, err := conn.ReadOffsets()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), first)
+	assert.Equal(t, int64(2), last)
+
+	_, err = conn.Seek(1, kafka.SeekAbsolute)
+	require.NoError(t, err)
+	msg, err := conn.ReadMessage(1024)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), msg.Offset)
+	assert.Equal(t, []byte("m2"), msg.Value)
+
+	_, err = conn.Seek(5, kafka.SeekAbsolute|kafka.SeekDontCheck)
+	require.NoError(t, err)
+	_, err = conn.ReadMessage(1024)
+	assert.ErrorIs(t, err, kafka.OffsetOutOfRange)
+}
+
+func TestServer_Faults(t *testing.T) {
+	broker := NewBroker(1)
+	server := newTestServer(t, broker)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	writer := &kafka.Writer{
+		Addr:                   kafka.TCP(server.Addr()),
+		Topic:                  "orders",
+		RequiredAcks:           kafka.RequireAll,
+		AllowAutoTopicCreation: true,
+		BatchTimeout:           time.Millisecond,
+		WriteBackoffMin:        time.Millisecond,
+		WriteBackoffMax:        time.Millisecond,
+	}
+	defer writer.Close()
+
+	// the writer retries temporary errors
+	broker.FailWrites(1, kafka.NotEnoughReplicas)
+	require.NoError(t, writer.WriteMessages(ctx, kafka.Message{Value: []byte("m1")}))
+	assert.Len(t, broker.Messages("orders", 0), 1)
+
+	writer.MaxAttempts = 1
+	broker.FailWrites(1, kafka.NotEnoughReplicas)
+	err := writer.WriteMessages(ctx, kafka.Message{Value: []byte("m2")})
+	var errs kafka.WriteErrors
+	require.ErrorAs(t, err, &errs)
+	assert.ErrorIs(t, errs[0], kafka.NotEnoughReplicas)
+	assert.Len(t, broker.Messages("orders", 0), 1)
+
+	// a failed record fails its partition, dropped records are acknowledged but not stored
+	broker.FailPartialWrites(1, 1, kafka.NotEnoughReplicas)
+	err = writer.WriteMessages(ctx, kafka.Message{Value: []byte("m3")})
+	require.ErrorAs(t, err, &errs)
+	assert.ErrorIs(t, errs[0], kafka.NotEnoughReplicas)
+	assert.Len(t, broker.Messages("orders", 0), 1)
+
+	broker.DropMessages(1)
+	require.NoError(t, writer.WriteMessages(ctx, kafka.Message{Value: []byte("m4")}))
+	assert.Len(t, broker.Messages("orders", 0), 1)
+	broker.ClearFaults()
+
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers: []string{server.Addr()},
+		Topic:   "orders",
+		MaxWait: 10 * time.Millisecond,
+	})
+	defer reader.Close()
+
+	// the reader retries failed fetches
+	broker.FailReads(1, kafka.RequestTimedOut)
+	msg, err := reader.ReadMessage(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("m1"), msg.Value)
+}
+
+// partitionBalancer writes all messages to one partition.
+type partitionBalancer int
+
+func (p partitionBalancer) Balance(kafka.Message, ...int) int {
+	return int(p)
+}
@@ -0,0 +1,182 @@
+package sqlmock
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Argument matches an actual query argument.
+// An Argument can be passed to ExpectQuery, Match or WithArgs in place of a value.
+type Argument interface {
+	Match(v driver.Value) bool
+}
+
+type anyArg struct{}
+
+// AnyArg matches any argument.
+func AnyArg() Argument {
+	return anyArg{}
+}
+
+func (anyArg) Match(driver.Value) bool {
+	return true
+}
+
+func (anyArg) String() string {
+	return "AnyArg()"
+}
+
+type anyOfType[T any] struct{}
+
+// AnyOfType matches any argument of type T.
+// Because arguments are converted by the driver before matching, a value converted
+// from T, such as int64 for int, also matches.
+func AnyOfType[T any]() Argument {
+	return anyOfType[T]{}
+}
+
+func (anyOfType[T]) Match(v driver.Value) bool {
+	if _, ok := v.(T); ok {
+		return true
+	}
+
+	var zero T
+	converted, err := driver.DefaultParameterConverter.ConvertValue(zero)
+	if err != nil || converted == nil || v == nil {
+		return false
+	}
+	return reflect.TypeOf(converted) == reflect.TypeOf(v)
+}
+
+func (anyOfType[T]) String() string {
+	return fmt.Sprintf("AnyOfType[%s]()", reflect.TypeFor[T]())
+}
+
+type timeWithin struct {
+	d time.Duration
+}
+
+// TimeWithin matches a time.Time argument within d of the current time,
+// it is useful for generated timestamps such as created_at.
+func TimeWithin(d time.Duration) Argument {
+	return timeWithin{d: d}
+}
+
+func (tw timeWithin) Match(v driver.Value) bool {
+	t, ok := v.(time.Time)
+	if !ok {
+		return false
+	}
+
+	diff := time.Since(t)
+	if diff < 0 {
+		diff = -diff
+	}
+	return diff <= tw.d
+}
+
+func (tw timeWithin) String() string {
+	return fmt.Sprintf("TimeWithin(%s)", tw.d)
+}
+
+type regexpArg struct {
+	re *regexp.Regexp
+}
+
+// Regexp matches a string or []byte argument against the regular expression pattern,
+// it panics if pattern can not be compiled.
+func Regexp(pattern string) Argument {
+	return regexpArg{re: regexp.MustCompile(pattern)}
+}
+
+func (ra regexpArg) Match(v driver.Value) bool {
+	switch v := v.(type) {
+	case string:
+		return ra.re.MatchString(v)
+	case []byte:
+		return ra.re.Match(v)
+	default:
+		return false
+	}
+}
+
+func (ra regexpArg) String() string {
+	return fmt.Sprintf("Regexp(%q)", ra.re)
+}
+
+type funcArg func(driver.Value) bool
+
+// Func matches an argument with the function fn.
+func Func(fn func(driver.Value) bool) Argument {
+	return funcArg(fn)
+}
+
+func (fa funcArg) Match(v driver.Value) bool {
+	return fa(v)
+}
+
+func (fa funcArg) String() string {
+	return "Func()"
+}
+
+// matchArgs reports whether the actual arguments match the expected ones.
+// Expected arguments created by sql.Named match the actual argument with the same name,
+// other arguments match by position.
+func matchArgs(expected []driver.Value, actual []driver.NamedValue) bool {
+	if len(expected) != len(actual) {
+		return false
+	}
+
+	for i := range expected {
+		if !matchArg(expected[i], actual, i) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchArg reports whether the expected argument at position i matches.
+func matchArg(expected driver.Value, actual []driver.NamedValue, i int) bool {
+	if named, ok := expected.(sql.NamedArg); ok {
+		for _, arg := range actual {
+			if arg.Name == named.Name {
+				return matchValue(named.Value, arg.Value)
+			}
+		}
+		return false
+	}
+
+	return matchValue(expected, actual[i].Value)
+}
+
+func matchValue(expected, actual driver.Value) bool {
+	if arg, ok := expected.(Argument); ok {
+		return arg.Match(actual)
+	}
+
+	a, _ := json.Marshal(expected)
+	b, _ := json.Marshal(actual)
+
+	return bytes.Equal(a, b)
+}
+
+// formatArgs formats actual arguments for error messages, named arguments are shown as name=value.
+func formatArgs(args []driver.NamedValue) string {
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			parts[i] = fmt.Sprintf("%s=%v", arg.Name, arg.Value)
+		} else {
+			parts[i] = fmt.Sprintf("%v", arg.Value)
+		}
+	}
+	return "[" + strings.Join(parts, " ") + "]"
+}
@@ -0,0 +1,101 @@
+package sqlmock_test
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/smallnest/exp/sqlmock"
+)
+
+func TestArgumentMatchers(t *testing.T) {
+	tests := []struct {
+		name  string
+		arg   sqlmock.Argument
+		value driver.Value
+		want  bool
+	}{
+		{"AnyArg", sqlmock.AnyArg(), "anything", true},
+		{"AnyArg nil", sqlmock.AnyArg(), nil, true},
+		{"AnyOfType string", sqlmock.AnyOfType[string](), "Alice", true},
+		{"AnyOfType string mismatch", sqlmock.AnyOfType[string](), int64(1), false},
+		{"AnyOfType converted int", sqlmock.AnyOfType[int](), int64(1), true},
+		{"AnyOfType time", sqlmock.AnyOfType[time.Time](), time.Now(), true},
+		{"AnyOfType nil", sqlmock.AnyOfType[int](), nil, false},
+		{"TimeWithin", sqlmock.TimeWithin(time.Second), time.Now(), true},
+		{"TimeWithin too old", sqlmock.TimeWithin(time.Second), time.Now().Add(-time.Minute), false},
+		{"TimeWithin not time", sqlmock.TimeWithin(time.Second), "now", false},
+		{"Regexp string", sqlmock.Regexp(`^[0-9a-f-]{36}$`), "6ba7b810-9dad-11d1-80b4-00c04fd430c8", true},
+		{"Regexp bytes", sqlmock.Regexp(`^a`), []byte("abc"), true},
+		{"Regexp mismatch", sqlmock.Regexp(`^a`), "bcd", false},
+		{"Func", sqlmock.Func(func(v driver.Value) bool { return v.(int64) > 18 }), int64(30), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.arg.Match(tt.value); got != tt.want {
+				t.Errorf("Match(%v) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithArgs_Matchers(t *testing.T) {
+	mockDB := sqlmock.NewMock()
+
+	mockDB.ExpectQuery("INSERT INTO events (id, name, created_at) VALUES (?, ?, ?)").
+		WithArgs(sqlmock.Regexp(`^[0-9a-f-]{36}$`), sqlmock.AnyOfType[string](), sqlmock.TimeWithin(time.Minute))
+
+	db, err := mockDB.Open("mock")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+
+	_, err = db.Exec("INSERT INTO events (id, name, created_at) VALUES (?, ?, ?)",
+		"6ba7b810-9dad-11d1-80b4-00c04fd430c8", "signup", time.Now())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = db.Exec("INSERT INTO events (id, name, created_at) VALUES (?, ?, ?)",
+		"not-a-uuid", "signup", time.Now())
+	if err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+
+	if err := mockDB.ExpectationsWereMet(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestWithArgs_Named(t *testing.T) {
+	mockDB := sqlmock.NewMock()
+
+	mockDB.ExpectQuery("SELECT id, name, age FROM users WHERE name = :name AND age > :age").
+		WithArgs(sql.Named("age", 18), sql.Named("name", sqlmock.AnyArg())).
+		WillReturnRows([]string{"id", "name", "age"}, [][]driver.Value{
+			{1, "John Doe", 30},
+		})
+
+	db, err := mockDB.Open("mock")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+
+	var user User
+	err = db.QueryRow("SELECT id, name, age FROM users WHERE name = :name AND age > :age",
+		sql.Named("name", "John Doe"), sql.Named("age", 18)).Scan(&user.ID, &user.Name, &user.Age)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if user.ID != 1 {
+		t.Errorf("unexpected user: %+v", user)
+	}
+
+	err = db.QueryRow("SELECT id, name, age FROM users WHERE name = :name AND age > :age",
+		sql.Named("name", "John Doe"), sql.Named("min_age", 18)).Scan(&user.ID, &user.Name, &user.Age)
+	if err == nil {
+		t.Fatalf("expected error for unknown named argument, got nil")
+	}
+}
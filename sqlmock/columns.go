@@ -0,0 +1,125 @@
+package sqlmock
+
+import (
+	"database/sql/driver"
+	"reflect"
+)
+
+var (
+	_ driver.RowsColumnTypeDatabaseTypeName = &MockRows{}
+	_ driver.RowsColumnTypeScanType         = &MockRows{}
+	_ driver.RowsColumnTypeNullable         = &MockRows{}
+	_ driver.RowsColumnTypeLength           = &MockRows{}
+	_ driver.RowsColumnTypePrecisionScale   = &MockRows{}
+)
+
+// scanTypeAny is the scan type of columns without a known type, the same as database/sql uses.
+var scanTypeAny = reflect.TypeFor[any]()
+
+// Column describes a column returned by a query, it is reported by rows.ColumnTypes().
+type Column struct {
+	name     string
+	dbType   string
+	scanType reflect.Type
+
+	nullable    bool
+	hasNullable bool
+
+	length    int64
+	hasLength bool
+
+	precision       int64
+	scale           int64
+	hasDecimalScale bool
+}
+
+// NewColumn creates a column definition named name.
+func NewColumn(name string) *Column {
+	return &Column{name: name}
+}
+
+// Name returns the name of the column.
+func (c *Column) Name() string {
+	return c.name
+}
+
+// OfType sets the database type name, such as VARCHAR or INT, and the scan type,
+// which is the type of example.
+func (c *Column) OfType(dbType string, example any) *Column {
+	c.dbType = dbType
+	if example != nil {
+		c.scanType = reflect.TypeOf(example)
+	}
+	return c
+}
+
+// Nullable sets whether the column may be null.
+func (c *Column) Nullable(nullable bool) *Column {
+	c.nullable = nullable
+	c.hasNullable = true
+	return c
+}
+
+// WithLength sets the length of variable length column types such as VARCHAR or BLOB.
+func (c *Column) WithLength(length int64) *Column {
+	c.length = length
+	c.hasLength = true
+	return c
+}
+
+// WithPrecisionAndScale sets the precision and scale of decimal column types.
+func (c *Column) WithPrecisionAndScale(precision, scale int64) *Column {
+	c.precision = precision
+	c.scale = scale
+	c.hasDecimalScale = true
+	return c
+}
+
+// WillReturnRowsWithColumns is like WillReturnRows, with typed column definitions.
+func (eq *ExpectedQuery) WillReturnRowsWithColumns(columns []*Column, rows [][]driver.Value) *ExpectedQuery {
+	eq.sets = []*RowSet{NewRowSetWithColumns(columns, rows)}
+	return eq
+}
+
+// column returns the definition of the column at index, or nil if the query has no column definitions.
+func (mr *MockRows) column(index int) *Column {
+	if types := mr.current().columnTypes; index < len(types) {
+		return types[index]
+	}
+	return nil
+}
+
+func (mr *MockRows) ColumnTypeDatabaseTypeName(index int) string {
+	if c := mr.column(index); c != nil {
+		return c.dbType
+	}
+	return ""
+}
+
+func (mr *MockRows) ColumnTypeScanType(index int) reflect.Type {
+	if c := mr.column(index); c != nil && c.scanType != nil {
+		return c.scanType
+	}
+	return scanTypeAny
+}
+
+func (mr *MockRows) ColumnTypeNullable(index int) (nullable, ok bool) {
+	if c := mr.column(index); c != nil {
+		return c.nullable, c.hasNullable
+	}
+	return false, false
+}
+
+func (mr *MockRows) ColumnTypeLength(index int) (length int64, ok bool) {
+	if c := mr.column(index); c != nil {
+		return c.length, c.hasLength
+	}
+	return 0, false
+}
+
+func (mr *MockRows) ColumnTypePrecisionScale(index int) (precision, scale int64, ok bool) {
+	if c := mr.column(index); c != nil {
+		return c.precision, c.scale, c.hasDecimalScale
+	}
+	return 0, 0, false
+}
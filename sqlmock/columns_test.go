@@ -0,0 +1,119 @@
+package sqlmock_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"reflect"
+	"testing"
+
+	"github.com/smallnest/exp/db"
+	"github.com/smallnest/exp/sqlmock"
+)
+
+func TestWillReturnRowsWithColumns(t *testing.T) {
+	mockDB := sqlmock.NewMock()
+
+	mockDB.ExpectQuery("SELECT id, name, balance FROM accounts").
+		WillReturnRowsWithColumns([]*sqlmock.Column{
+			sqlmock.NewColumn("id").OfType("BIGINT", int64(0)).Nullable(false),
+			sqlmock.NewColumn("name").OfType("VARCHAR", "").Nullable(true).WithLength(255),
+			sqlmock.NewColumn("balance").OfType("DECIMAL", float64(0)).WithPrecisionAndScale(10, 2),
+		}, [][]driver.Value{
+			{int64(1), "alice", 10.5},
+		})
+
+	sqlDB, err := mockDB.Open("mock")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+
+	rows, err := sqlDB.Query("SELECT id, name, balance FROM accounts")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer rows.Close()
+
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(types) != 3 {
+		t.Fatalf("expected 3 column types, got %d", len(types))
+	}
+
+	if types[0].Name() != "id" || types[0].DatabaseTypeName() != "BIGINT" || types[0].ScanType() != reflect.TypeOf(int64(0)) {
+		t.Errorf("unexpected id column: %s %s %v", types[0].Name(), types[0].DatabaseTypeName(), types[0].ScanType())
+	}
+	if nullable, ok := types[0].Nullable(); !ok || nullable {
+		t.Errorf("expected id not nullable, got %v %v", nullable, ok)
+	}
+
+	if nullable, ok := types[1].Nullable(); !ok || !nullable {
+		t.Errorf("expected name nullable, got %v %v", nullable, ok)
+	}
+	if length, ok := types[1].Length(); !ok || length != 255 {
+		t.Errorf("expected name length 255, got %v %v", length, ok)
+	}
+	if _, _, ok := types[1].DecimalSize(); ok {
+		t.Errorf("expected name without decimal size")
+	}
+
+	if precision, scale, ok := types[2].DecimalSize(); !ok || precision != 10 || scale != 2 {
+		t.Errorf("expected balance decimal(10, 2), got %v %v %v", precision, scale, ok)
+	}
+	if _, ok := types[2].Nullable(); ok {
+		t.Errorf("expected balance nullability unknown")
+	}
+}
+
+func TestWillReturnRows_ColumnTypes(t *testing.T) {
+	mockDB := sqlmock.NewMock()
+
+	mockDB.ExpectQuery("SELECT id FROM users").
+		WillReturnRows([]string{"id"}, [][]driver.Value{{1}})
+
+	sqlDB, err := mockDB.Open("mock")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+
+	rows, err := sqlDB.Query("SELECT id FROM users")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer rows.Close()
+
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if types[0].DatabaseTypeName() != "" || types[0].ScanType() != reflect.TypeFor[any]() {
+		t.Errorf("unexpected column type: %q %v", types[0].DatabaseTypeName(), types[0].ScanType())
+	}
+}
+
+func TestWillReturnRowsWithColumns_Scan(t *testing.T) {
+	mockDB := sqlmock.NewMock()
+
+	mockDB.ExpectQuery("SELECT id, name FROM persons").
+		WillReturnRowsWithColumns([]*sqlmock.Column{
+			sqlmock.NewColumn("id").OfType("INTEGER", int64(0)),
+			sqlmock.NewColumn("name").OfType("TEXT", ""),
+		}, [][]driver.Value{
+			{int64(1), "alice"},
+			{int64(2), "fred"},
+		})
+
+	sqlDB, err := mockDB.Open("mock")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+
+	persons, err := db.Rows[person](context.Background(), sqlDB, "SELECT id, name FROM persons")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(persons) != 2 || persons[0].Name != "alice" || persons[1].ID != 2 {
+		t.Errorf("unexpected persons: %+v", persons)
+	}
+}
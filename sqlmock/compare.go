@@ -1,164 +1,884 @@
 package sqlmock
 
 import (
-	"regexp"
+	"slices"
 	"sort"
 	"strings"
 )
 
-// Remove extra whitespace and punctuation
-func normalizeSQL(sql string) string {
-	// Convert to lowercase
-	sql = strings.ToLower(sql)
+// tokenKind is the kind of a SQL token
+type tokenKind int
 
-	// Remove extra whitespace
-	sql = regexp.MustCompile(`\s+`).ReplaceAllString(sql, " ")
+const (
+	tokWord        tokenKind = iota // keyword or unquoted identifier, lower-cased
+	tokIdent                        // quoted identifier, without quotes
+	tokString                       // string literal, with quotes
+	tokNumber                       // numeric literal
+	tokPlaceholder                  // ?, ?1, $1, :name or @name, always rendered as ?
+	tokPunct                        // operators and punctuation
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// is reports whether the token is the keyword word.
+func (t token) is(word string) bool {
+	return t.kind == tokWord && t.text == word
+}
+
+// isPunct reports whether the token is the punctuation p.
+func (t token) isPunct(p string) bool {
+	return t.kind == tokPunct && t.text == p
+}
 
-	// Remove whitespace inside parentheses
-	sql = regexp.MustCompile(`\(\s+`).ReplaceAllString(sql, "(")
-	sql = regexp.MustCompile(`\s+\)`).ReplaceAllString(sql, ")")
+// tokenize splits a SQL statement into tokens, comments and whitespace are dropped.
+func tokenize(sql string) []token {
+	var toks []token
+
+	n := len(sql)
+	for i := 0; i < n; {
+		c := sql[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			i++
+
+		case c == '-' && i+1 < n && sql[i+1] == '-': // line comment
+			for i < n && sql[i] != '\n' {
+				i++
+			}
+
+		case c == '/' && i+1 < n && sql[i+1] == '*': // block comment
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				i = n
+			} else {
+				i += end + 4
+			}
+
+		case c == '\'':
+			j := i + 1
+			for j < n {
+				if sql[j] == '\'' {
+					if j+1 < n && sql[j+1] == '\'' { // escaped quote
+						j += 2
+						continue
+					}
+					break
+				}
+				j++
+			}
+			end := min(j+1, n)
+			toks = append(toks, token{kind: tokString, text: sql[i:end]})
+			i = end
+
+		case c == '"' || c == '`' || (c == '[' && !isSubscript(toks)):
+			closing := c
+			if c == '[' {
+				closing = ']'
+			}
+			j := i + 1
+			for j < n && sql[j] != closing {
+				j++
+			}
+			toks = append(toks, token{kind: tokIdent, text: sql[i+1 : min(j, n)]})
+			i = min(j+1, n)
+
+		case c == '?':
+			j := i + 1
+			for j < n && isDigit(sql[j]) {
+				j++
+			}
+			toks = append(toks, token{kind: tokPlaceholder, text: "?"})
+			i = j
+
+		case c == '$' && i+1 < n && isDigit(sql[i+1]):
+			j := i + 1
+			for j < n && isDigit(sql[j]) {
+				j++
+			}
+			toks = append(toks, token{kind: tokPlaceholder, text: "?"})
+			i = j
+
+		case c == ':' && i+1 < n && sql[i+1] == ':': // PostgreSQL cast
+			toks = append(toks, token{kind: tokPunct, text: "::"})
+			i += 2
+
+		case (c == ':' || c == '@') && i+1 < n && isIdentStart(sql[i+1]):
+			j := i + 1
+			for j < n && isIdentPart(sql[j]) {
+				j++
+			}
+			toks = append(toks, token{kind: tokPlaceholder, text: "?"})
+			i = j
+
+		case isDigit(c) || (c == '.' && i+1 < n && isDigit(sql[i+1])):
+			j := i
+			for j < n && (isDigit(sql[j]) || sql[j] == '.' ||
+				((sql[j] == 'e' || sql[j] == 'E') && j+1 < n && (isDigit(sql[j+1]) || sql[j+1] == '-' || sql[j+1] == '+'))) {
+				if sql[j] == 'e' || sql[j] == 'E' {
+					j++ // skip the exponent sign
+				}
+				j++
+			}
+			toks = append(toks, token{kind: tokNumber, text: sql[i:j]})
+			i = j
+
+		case isIdentStart(c):
+			j := i
+			for j < n && isIdentPart(sql[j]) {
+				j++
+			}
+			toks = append(toks, token{kind: tokWord, text: strings.ToLower(sql[i:j])})
+			i = j
+
+		default:
+			text := sql[i : i+1]
+			if i+1 < n {
+				switch two := sql[i : i+2]; two {
+				case "<=", ">=", "<>", "!=", "||", "->":
+					text = two
+					if two == "->" && i+2 < n && sql[i+2] == '>' {
+						text = "->>"
+					}
+				}
+			}
+			i += len(text)
+
+			if text == "!=" {
+				text = "<>"
+			}
+			toks = append(toks, token{kind: tokPunct, text: text})
+		}
+	}
 
-	// Remove whitespace around commas
-	sql = regexp.MustCompile(`\s*,\s*`).ReplaceAllString(sql, ",")
+	return toks
+}
 
-	// Remove trailing semicolon
-	sql = strings.TrimSuffix(sql, ";")
+// isSubscript reports whether a [ following toks is a subscript such as arr[1], not a quoted identifier:
+// it follows an identifier, a closing parenthesis or bracket, or a placeholder.
+func isSubscript(toks []token) bool {
+	if len(toks) == 0 {
+		return false
+	}
 
-	return strings.TrimSpace(sql)
+	prev := toks[len(toks)-1]
+	switch prev.kind {
+	case tokWord:
+		return !keywords[prev.text]
+	case tokIdent, tokPlaceholder:
+		return true
+	case tokPunct:
+		return prev.text == ")" || prev.text == "]"
+	default:
+		return false
+	}
 }
 
-// Extract key components of a SELECT statement
-func extractSelectComponents(sql string) map[string]string {
-	components := make(map[string]string)
+// keywords are the keywords which may precede a quoted identifier.
+var keywords = map[string]bool{
+	"select": true, "from": true, "where": true, "and": true, "or": true, "not": true, "on": true,
+	"join": true, "by": true, "as": true, "into": true, "update": true, "set": true, "table": true,
+	"distinct": true, "all": true, "having": true, "when": true, "then": true, "else": true,
+	"case": true, "in": true, "values": true, "using": true, "returning": true, "top": true,
+}
 
-	// Use regular expressions to extract parts
-	selectRegex := regexp.MustCompile(`select\s+(.*?)\s+from\s+(.*?)(?:\s+where\s+(.*?))?(?:\s+order\s+by\s+(.*?))?(?:\s+limit\s+(.*?))?$`)
-	matches := selectRegex.FindStringSubmatch(sql)
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
 
-	if len(matches) > 1 {
-		// Extract columns
-		columns := extractAndSortColumns(matches[1])
-		components["columns"] = strings.Join(columns, ",")
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
 
-		// Extract table
-		components["from"] = normalizeSQL(matches[2])
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || isDigit(c) || c == '$'
+}
 
-		// Extract WHERE clause (if exists)
-		if len(matches) > 3 && matches[3] != "" {
-			components["where"] = normalizeWhereClause(matches[3])
+// matchParen returns the index of the parenthesis closing the one at i,
+// or len(toks) if it is not closed.
+func matchParen(toks []token, i int) int {
+	depth := 0
+	for j := i; j < len(toks); j++ {
+		switch {
+		case toks[j].isPunct("("):
+			depth++
+		case toks[j].isPunct(")"):
+			depth--
+			if depth == 0 {
+				return j
+			}
 		}
+	}
+	return len(toks)
+}
+
+// unwrap removes parentheses enclosing the whole token list.
+func unwrap(toks []token) []token {
+	for len(toks) >= 2 && toks[0].isPunct("(") && matchParen(toks, 0) == len(toks)-1 {
+		toks = toks[1 : len(toks)-1]
+	}
+	return toks
+}
 
-		// Extract ORDER BY (if exists)
-		if len(matches) > 4 && matches[4] != "" {
-			components["order_by"] = normalizeOrderBy(matches[4])
+// splitTop splits toks at the top-level tokens accepted by sep, separators are dropped.
+// Tokens inside parentheses and CASE expressions are never separators.
+func splitTop(toks []token, sep func(toks []token, i int) bool) [][]token {
+	var parts [][]token
+
+	depth, start := 0, 0
+	for i, t := range toks {
+		switch {
+		case t.isPunct("(") || t.is("case"):
+			depth++
+		case t.isPunct(")") || t.is("end"):
+			depth--
+		default:
+			if depth == 0 && sep(toks, i) {
+				parts = append(parts, toks[start:i])
+				start = i + 1
+			}
 		}
+	}
+
+	return append(parts, toks[start:])
+}
+
+func isComma(toks []token, i int) bool {
+	return toks[i].isPunct(",")
+}
+
+func isWord(word string) func(toks []token, i int) bool {
+	return func(toks []token, i int) bool {
+		return toks[i].is(word)
+	}
+}
+
+// removeTopWord drops the top-level occurrences of word, such as AS in aliases.
+func removeTopWord(toks []token, word string) []token {
+	var result []token
+	for _, part := range splitTop(toks, isWord(word)) {
+		result = append(result, part...)
+	}
+	return result
+}
 
-		// Extract LIMIT (if exists)
-		if len(matches) > 5 && matches[5] != "" {
-			components["limit"] = matches[5]
+// clause is a part of a statement introduced by a keyword such as WHERE or ORDER BY.
+type clause struct {
+	name string
+	toks []token
+}
+
+// splitClauses splits toks at the top-level keywords, a keyword followed by BY is merged with it.
+// The first clause has an empty name and holds the tokens before the first keyword.
+func splitClauses(toks []token, keywords ...string) []clause {
+	clauses := []clause{{}}
+
+	depth := 0
+	for i := 0; i < len(toks); i++ {
+		t := toks[i]
+		switch {
+		case t.isPunct("(") || t.is("case"):
+			depth++
+		case t.isPunct(")") || t.is("end"):
+			depth--
+		case depth == 0 && t.kind == tokWord && slices.Contains(keywords, t.text):
+			name := t.text
+			if i+1 < len(toks) && toks[i+1].is("by") {
+				name += " by"
+				i++
+			}
+			clauses = append(clauses, clause{name: name})
+			continue
 		}
+
+		clauses[len(clauses)-1].toks = append(clauses[len(clauses)-1].toks, t)
 	}
 
-	return components
+	return clauses
 }
 
-// Extract and sort column names
-func extractAndSortColumns(columnsStr string) []string {
-	// Handle * case
-	if strings.TrimSpace(columnsStr) == "*" {
-		return []string{"*"}
+// renderTokens renders tokens with canonical spacing, subqueries are normalized recursively.
+func renderTokens(toks []token) string {
+	var b strings.Builder
+
+	var prev *token
+	for i := 0; i < len(toks); i++ {
+		t := toks[i]
+
+		if b.Len() > 0 && !t.isPunct(",") && !t.isPunct(")") && !t.isPunct(".") && !t.isPunct("::") &&
+			!prev.isPunct("(") && !prev.isPunct(".") && !prev.isPunct("::") &&
+			!(t.isPunct("(") && isFuncName(*prev)) {
+			b.WriteByte(' ')
+		}
+
+		if t.isPunct("(") {
+			j := matchParen(toks, i)
+			b.WriteByte('(')
+			b.WriteString(renderGroup(toks[i+1 : j]))
+			b.WriteByte(')')
+
+			i = min(j, len(toks)-1)
+			prev = &toks[i]
+			continue
+		}
+
+		b.WriteString(t.text)
+		prev = &toks[i]
 	}
 
-	// Split column names
-	columns := strings.Split(columnsStr, ",")
+	return b.String()
+}
 
-	// Remove aliases and whitespace
-	cleanColumns := make([]string, 0)
-	for _, col := range columns {
-		col = strings.TrimSpace(col)
+// spacedWords are keywords which may be followed by parentheses but are not function calls.
+var spacedWords = map[string]bool{
+	"in": true, "exists": true, "values": true, "on": true, "using": true, "as": true,
+	"and": true, "or": true, "not": true, "any": true, "all": true, "some": true,
+}
 
-		// Remove possible aliases
-		if strings.Contains(col, " as ") {
-			col = strings.Split(col, " as ")[0]
-		} else if strings.Contains(col, " ") {
-			col = strings.Split(col, " ")[0]
+// isFuncName reports whether t followed by parentheses is rendered as a function call.
+func isFuncName(t token) bool {
+	return t.kind == tokIdent || (t.kind == tokWord && !spacedWords[t.text])
+}
+
+// renderGroup renders the tokens inside parentheses.
+func renderGroup(toks []token) string {
+	if len(toks) > 0 && (toks[0].is("select") || toks[0].is("with")) {
+		return normalizeStatement(toks)
+	}
+	return renderTokens(toks)
+}
+
+// renderList renders comma separated items, sorted if requested, see sortUnbound.
+func renderList(toks []token, sorted bool, render func([]token) string) string {
+	parts := splitTop(toks, isComma)
+	items := make([]string, 0, len(parts))
+	bound := make([]bool, 0, len(parts))
+	for _, part := range parts {
+		items = append(items, render(part))
+		bound = append(bound, hasPlaceholder(part))
+	}
+
+	if sorted {
+		items = sortUnbound(items, bound)
+	}
+	return strings.Join(items, ", ")
+}
+
+// hasPlaceholder reports whether toks contain a placeholder.
+func hasPlaceholder(toks []token) bool {
+	for _, t := range toks {
+		if t.kind == tokPlaceholder {
+			return true
 		}
+	}
+	return false
+}
 
-		cleanColumns = append(cleanColumns, col)
+// sortUnbound sorts the items without placeholders, followed by the items with placeholders in their order:
+// arguments are bound to placeholders by position, so reordering them would bind arguments to other columns.
+func sortUnbound(items []string, bound []bool) []string {
+	var unbound, ordered []string
+	for i, item := range items {
+		if bound[i] {
+			ordered = append(ordered, item)
+		} else {
+			unbound = append(unbound, item)
+		}
 	}
 
-	// Sort
-	sort.Strings(cleanColumns)
-	return cleanColumns
+	sort.Strings(unbound)
+	return append(unbound, ordered...)
+}
+
+// expr is a boolean expression, operands of AND and OR are commutative.
+type expr struct {
+	op       string // "and", "or", or empty for a leaf
+	leaf     string
+	children []*expr
+	// bound reports whether the expression has placeholders, its operands are then not reordered.
+	bound bool
 }
 
-// Normalize WHERE clause
-func normalizeWhereClause(whereClause string) string {
-	// Remove extra whitespace
-	whereClause = normalizeSQL(whereClause)
+func parseExpr(toks []token) *expr {
+	toks = unwrap(toks)
+	if len(toks) > 0 && (toks[0].is("select") || toks[0].is("with")) {
+		return &expr{leaf: "(" + normalizeStatement(toks) + ")", bound: hasPlaceholder(toks)}
+	}
 
-	// Split conditions
-	conditions := strings.Split(whereClause, " and ")
+	if ors := splitTop(toks, isWord("or")); len(ors) > 1 {
+		return newExpr("or", ors)
+	}
 
-	// Sort conditions
-	sort.Strings(conditions)
+	// the AND of BETWEEN x AND y is not a conjunction
+	between := false
+	ands := splitTop(toks, func(toks []token, i int) bool {
+		switch {
+		case toks[i].is("between"):
+			between = true
+		case toks[i].is("and"):
+			if between {
+				between = false
+				return false
+			}
+			return true
+		}
+		return false
+	})
+	if len(ands) > 1 {
+		return newExpr("and", ands)
+	}
 
-	return strings.Join(conditions, " and ")
+	return &expr{leaf: renderTokens(toks), bound: hasPlaceholder(toks)}
 }
 
-// Normalize ORDER BY clause
-func normalizeOrderBy(orderBy string) string {
-	// Remove extra whitespace
-	orderBy = normalizeSQL(orderBy)
+// newExpr creates an AND or OR expression, nested expressions with the same operator are flattened.
+func newExpr(op string, operands [][]token) *expr {
+	e := &expr{op: op}
+	for _, operand := range operands {
+		child := parseExpr(operand)
+		if child.op == op {
+			e.children = append(e.children, child.children...)
+		} else {
+			e.children = append(e.children, child)
+		}
+		e.bound = e.bound || child.bound
+	}
+	return e
+}
 
-	// Split sorting conditions
-	sorts := strings.Split(orderBy, ",")
+func (e *expr) String() string {
+	if e.op == "" {
+		return e.leaf
+	}
 
-	// Sort and remove ASC/DESC
-	cleanSorts := make([]string, 0)
-	for _, sort := range sorts {
-		// Remove ASC/DESC
-		sort = strings.TrimSuffix(sort, " asc")
-		sort = strings.TrimSuffix(sort, " desc")
-		cleanSorts = append(cleanSorts, strings.TrimSpace(sort))
+	items := make([]string, 0, len(e.children))
+	bound := make([]bool, 0, len(e.children))
+	for _, child := range e.children {
+		s := child.String()
+		if child.op != "" {
+			s = "(" + s + ")"
+		}
+		items = append(items, s)
+		bound = append(bound, child.bound)
 	}
 
-	// Sort
-	sort.Strings(cleanSorts)
-	return strings.Join(cleanSorts, ",")
+	return strings.Join(sortUnbound(items, bound), " "+e.op+" ")
 }
 
-// Compare if two SQL statements are semantically equal
-func CompareSQL(sql1, sql2 string) bool {
-	// Normalize SQL statements
-	normSql1 := normalizeSQL(sql1)
-	normSql2 := normalizeSQL(sql2)
+func normalizeExpr(toks []token) string {
+	return parseExpr(toks).String()
+}
+
+// normalizeAliased renders a select item or a table reference, "x AS y" is rendered as "x y".
+func normalizeAliased(toks []token) string {
+	return renderTokens(removeTopWord(toks, "as"))
+}
+
+// normalizeOrderItem renders an ORDER BY item, ASC is the default direction.
+func normalizeOrderItem(toks []token) string {
+	if n := len(toks); n > 1 && toks[n-1].is("asc") {
+		toks = toks[:n-1]
+	}
+	return renderTokens(toks)
+}
+
+var joinWords = map[string]bool{
+	"join": true, "inner": true, "left": true, "right": true, "full": true,
+	"outer": true, "cross": true, "natural": true, "straight_join": true,
+}
+
+// normalizeFrom normalizes a FROM clause with its joins.
+// Comma separated tables are sorted, INNER and OUTER are dropped from join types
+// and join conditions are normalized as expressions.
+func normalizeFrom(toks []token) string {
+	type segment struct {
+		join []string
+		toks []token
+	}
+	segments := []segment{{}}
+
+	depth := 0
+	for i := 0; i < len(toks); i++ {
+		t := toks[i]
+		switch {
+		case t.isPunct("("):
+			depth++
+		case t.isPunct(")"):
+			depth--
+		case depth == 0 && t.kind == tokWord && joinWords[t.text]:
+			var join []string
+			for ; i < len(toks) && toks[i].kind == tokWord && joinWords[toks[i].text]; i++ {
+				if !toks[i].is("inner") && !toks[i].is("outer") {
+					join = append(join, toks[i].text)
+				}
+			}
+			segments = append(segments, segment{join: join})
+			i--
+			continue
+		}
+
+		segments[len(segments)-1].toks = append(segments[len(segments)-1].toks, t)
+	}
+
+	parts := []string{renderList(segments[0].toks, true, normalizeAliased)}
+	for _, seg := range segments[1:] {
+		part := strings.Join(seg.join, " ")
+
+		on := splitTop(seg.toks, isWord("on"))
+		part += " " + normalizeAliased(on[0])
+		if len(on) > 1 {
+			var cond []token
+			for _, c := range on[1:] {
+				cond = append(cond, c...)
+			}
+			part += " on " + normalizeExpr(cond)
+		}
+		parts = append(parts, part)
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// normalizeClause renders a clause of SELECT, UPDATE or DELETE.
+func normalizeClause(c clause) string {
+	var body string
+	switch c.name {
+	case "from", "using":
+		body = normalizeFrom(c.toks)
+	case "where", "having":
+		body = normalizeExpr(c.toks)
+	case "group by":
+		body = renderList(c.toks, true, renderTokens)
+	case "order by":
+		body = renderList(c.toks, false, normalizeOrderItem)
+	case "set":
+		// MySQL evaluates the assignments from left to right
+		body = renderList(c.toks, false, renderTokens)
+	default:
+		body = renderTokens(c.toks)
+	}
 
-	// If exactly the same, return true
-	if normSql1 == normSql2 {
+	return c.name + " " + body
+}
+
+var setOperators = map[string]bool{"union": true, "intersect": true, "except": true}
+
+// normalizeQuery normalizes a SELECT, which may be combined with UNION, INTERSECT or EXCEPT.
+// The select list is sorted only if top is set and the SELECT is not combined: the columns of
+// combined SELECTs, and of nested ones such as the SELECT of an INSERT, are paired by position.
+func normalizeQuery(toks []token, top bool) string {
+	var b strings.Builder
+
+	ops := []string{""}
+	parts := splitTop(toks, func(toks []token, i int) bool {
+		if toks[i].kind != tokWord || !setOperators[toks[i].text] {
+			return false
+		}
+
+		op := toks[i].text
+		if i+1 < len(toks) && (toks[i+1].is("all") || toks[i+1].is("distinct")) {
+			op += " " + toks[i+1].text
+		}
+		ops = append(ops, op)
 		return true
+	})
+
+	for i, part := range parts {
+		if i > 0 {
+			// drop the ALL or DISTINCT merged into the operator
+			if strings.Contains(ops[i], " ") && len(part) > 0 {
+				part = part[1:]
+			}
+			b.WriteString(" " + ops[i] + " ")
+		}
+
+		if inner := unwrap(part); len(inner) < len(part) {
+			b.WriteString("(" + normalizeStatement(inner) + ")")
+		} else {
+			b.WriteString(normalizeSelect(part, top && len(parts) == 1))
+		}
+	}
+
+	return b.String()
+}
+
+func normalizeSelect(toks []token, sorted bool) string {
+	if len(toks) == 0 || !toks[0].is("select") {
+		return renderTokens(toks)
+	}
+
+	clauses := splitClauses(toks[1:], "from", "where", "group", "having", "window", "order", "limit", "offset", "fetch", "for")
+
+	parts := []string{"select"}
+
+	list := clauses[0].toks
+	if len(list) > 0 && (list[0].is("distinct") || list[0].is("all")) {
+		if list[0].is("distinct") {
+			parts = append(parts, "distinct")
+		}
+		list = list[1:]
+	}
+	parts = append(parts, renderList(list, sorted, normalizeAliased))
+
+	for _, c := range clauses[1:] {
+		parts = append(parts, normalizeClause(c))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// normalizeInsert normalizes an INSERT or REPLACE, column and value pairs are sorted by column.
+func normalizeInsert(toks []token) string {
+	i := 0
+	for i < len(toks) && !toks[i].is("into") {
+		i++
+	}
+	if i == len(toks) {
+		return renderTokens(toks)
+	}
+	head := renderTokens(toks[:i+1])
+	i++
+
+	tableStart := i
+	for i < len(toks) && !toks[i].isPunct("(") && !toks[i].is("values") && !toks[i].is("value") &&
+		!toks[i].is("select") && !toks[i].is("with") && !toks[i].is("default") && !toks[i].is("set") {
+		i++
+	}
+	table := normalizeAliased(toks[tableStart:i])
+
+	var columns []string
+	if i < len(toks) && toks[i].isPunct("(") {
+		j := matchParen(toks, i)
+		if j > i+1 && (toks[i+1].is("select") || toks[i+1].is("with")) {
+			// INSERT INTO t (SELECT ...) without a column list
+			return head + " " + table + " " + renderTokens(toks[i:])
+		}
+		for _, col := range splitTop(toks[i+1:j], isComma) {
+			columns = append(columns, renderTokens(col))
+		}
+		i = min(j+1, len(toks))
+	}
+
+	rest := toks[i:]
+	if len(rest) == 0 || !(rest[0].is("values") || rest[0].is("value")) {
+		// INSERT ... SELECT, INSERT ... DEFAULT VALUES or MySQL INSERT ... SET
+		s := head + " " + table
+		if columns != nil {
+			s += " (" + strings.Join(columns, ", ") + ")"
+		}
+		if len(rest) > 0 && rest[0].is("set") {
+			return s + " " + normalizeClause(clause{name: "set", toks: rest[1:]})
+		}
+		return s + " " + normalizeStatement(rest)
+	}
+
+	// collect the value rows, the tail holds ON CONFLICT, ON DUPLICATE KEY UPDATE or RETURNING
+	var rows [][]string
+	bound := make([]bool, len(columns))
+	j := 1
+	for j < len(rest) && rest[j].isPunct("(") {
+		k := matchParen(rest, j)
+		var row []string
+		for c, v := range splitTop(rest[j+1:min(k, len(rest))], isComma) {
+			row = append(row, renderTokens(v))
+			if c < len(bound) && hasPlaceholder(v) {
+				bound[c] = true
+			}
+		}
+		rows = append(rows, row)
+
+		j = k + 1
+		if j < len(rest) && rest[j].isPunct(",") {
+			j++
+			continue
+		}
+		break
+	}
+	tail := rest[min(j, len(rest)):]
+
+	// columns with placeholders keep their order, see sortUnbound
+	var order, ordered []int
+	for k := range columns {
+		if bound[k] {
+			ordered = append(ordered, k)
+		} else {
+			order = append(order, k)
+		}
 	}
+	sortable := len(columns) > 0
+	for _, row := range rows {
+		if len(row) != len(columns) {
+			sortable = false
+		}
+	}
+	if sortable {
+		sort.SliceStable(order, func(a, b int) bool { return columns[order[a]] < columns[order[b]] })
+	}
+	order = append(order, ordered...)
 
-	// Determine SQL type
-	switch {
-	case strings.HasPrefix(normSql1, "select") && strings.HasPrefix(normSql2, "select"):
-		return compareSelectStatements(normSql1, normSql2)
-	// Add other types of SQL statement comparisons as needed
+	var b strings.Builder
+	b.WriteString(head + " " + table)
+	if len(columns) > 0 {
+		b.WriteString(" (" + strings.Join(permute(columns, order, sortable), ", ") + ")")
+	}
+	b.WriteString(" values ")
+	for k, row := range rows {
+		if k > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString("(" + strings.Join(permute(row, order, sortable), ", ") + ")")
+	}
+	if len(tail) > 0 {
+		b.WriteString(" " + renderTokens(tail))
+	}
+
+	return b.String()
+}
+
+func permute(items []string, order []int, apply bool) []string {
+	if !apply {
+		return items
+	}
+
+	result := make([]string, len(items))
+	for k, idx := range order {
+		result[k] = items[idx]
+	}
+	return result
+}
+
+func normalizeUpdate(toks []token) string {
+	clauses := splitClauses(toks[1:], "set", "from", "where", "returning", "order", "limit")
+
+	parts := []string{"update", normalizeAliased(clauses[0].toks)}
+	for _, c := range clauses[1:] {
+		parts = append(parts, normalizeClause(c))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+func normalizeDelete(toks []token) string {
+	clauses := splitClauses(toks[1:], "from", "using", "where", "returning", "order", "limit")
+
+	parts := []string{"delete"}
+	if len(clauses[0].toks) > 0 {
+		parts = append(parts, renderTokens(clauses[0].toks))
+	}
+	for _, c := range clauses[1:] {
+		parts = append(parts, normalizeClause(c))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// normalizeWith normalizes common table expressions followed by the main statement, see normalizeQuery for top.
+func normalizeWith(toks []token, top bool) string {
+	parts := []string{"with"}
+
+	i := 1
+	if i < len(toks) && toks[i].is("recursive") {
+		parts = append(parts, "recursive")
+		i++
+	}
+
+	var ctes []string
+	for i < len(toks) {
+		start := i
+		for i < len(toks) && !toks[i].is("as") {
+			if toks[i].isPunct("(") {
+				i = matchParen(toks, i)
+			}
+			i++
+		}
+		name := renderTokens(toks[start:min(i, len(toks))])
+		i++ // AS
+
+		var modifiers []token
+		for i < len(toks) && toks[i].kind == tokWord {
+			modifiers = append(modifiers, toks[i])
+			i++
+		}
+		if i >= len(toks) || !toks[i].isPunct("(") {
+			return renderTokens(toks)
+		}
+
+		j := matchParen(toks, i)
+		cte := name + " as "
+		if len(modifiers) > 0 {
+			cte += renderTokens(modifiers) + " "
+		}
+		ctes = append(ctes, cte+"("+normalizeStatement(toks[i+1:j])+")")
+
+		i = j + 1
+		if i < len(toks) && toks[i].isPunct(",") {
+			i++
+			continue
+		}
+		break
+	}
+
+	parts = append(parts, strings.Join(ctes, ", "))
+	if i < len(toks) {
+		parts = append(parts, normalizeStatementTop(toks[i:], top))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// normalizeStatement returns the canonical form of a tokenized statement nested in another one.
+func normalizeStatement(toks []token) string {
+	return normalizeStatementTop(toks, false)
+}
+
+// normalizeStatementTop returns the canonical form of a tokenized statement, top is set for the
+// statement itself as opposed to a nested statement, see normalizeQuery.
+func normalizeStatementTop(toks []token, top bool) string {
+	for len(toks) > 0 && toks[len(toks)-1].isPunct(";") {
+		toks = toks[:len(toks)-1]
+	}
+	if len(toks) == 0 {
+		return ""
+	}
+
+	lead := toks
+	for len(lead) > 1 && lead[0].isPunct("(") {
+		lead = lead[1:]
+	}
+
+	switch first := lead[0]; {
+	case first.is("with"):
+		return normalizeWith(unwrap(toks), top)
+	case first.is("select"):
+		return normalizeQuery(toks, top)
+	case first.is("insert") || first.is("replace"):
+		return normalizeInsert(toks)
+	case first.is("update"):
+		return normalizeUpdate(toks)
+	case first.is("delete"):
+		return normalizeDelete(toks)
 	default:
-		return false
+		return renderTokens(toks)
 	}
 }
 
-// Compare SELECT statements
-func compareSelectStatements(sql1, sql2 string) bool {
-	// Extract components
-	comp1 := extractSelectComponents(sql1)
-	comp2 := extractSelectComponents(sql2)
+// canonicalSQL returns the canonical form of a SQL statement.
+// Keywords and unquoted identifiers are lower-cased, identifier quotes are removed,
+// placeholders are rendered as ?, and commutative parts such as the select list of the statement,
+// AND/OR operands and INSERT columns are sorted. Parts with placeholders keep their order,
+// as arguments are bound by position, and so do parts paired by position such as the select lists
+// of combined or nested SELECTs.
+func canonicalSQL(sql string) string {
+	return strings.TrimSpace(normalizeStatementTop(tokenize(sql), true))
+}
 
-	// Compare key components
-	return comp1["columns"] == comp2["columns"] &&
-		comp1["from"] == comp2["from"] &&
-		comp1["where"] == comp2["where"] &&
-		comp1["order_by"] == comp2["order_by"] &&
-		comp1["limit"] == comp2["limit"]
+// CompareSQL reports whether two SQL statements are semantically equal.
+// It understands SELECT (with joins, grouping, subqueries and set operations),
+// INSERT, UPDATE, DELETE and WITH statements, and ignores differences in
+// whitespace, keyword case, identifier quoting, placeholder style,
+// the order of the columns of a SELECT statement and the order of AND/OR operands without placeholders.
+func CompareSQL(sql1, sql2 string) bool {
+	return canonicalSQL(sql1) == canonicalSQL(sql2)
 }
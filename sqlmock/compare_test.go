@@ -16,3 +16,177 @@ func TestSQLCompare(t *testing.T) {
 		t.Errorf("SQL statements should not be semantically equal")
 	}
 }
+
+func TestCompareSQL_Equivalent(t *testing.T) {
+	tests := []struct {
+		name string
+		sql1 string
+		sql2 string
+	}{
+		{"keyword case and whitespace",
+			"SELECT id FROM users WHERE id = ?",
+			"select   id\n from users where id=?;"},
+		{"identifier quoting",
+			`SELECT "id", "name" FROM "users" WHERE "age" > ?`,
+			"SELECT `id`, [name] FROM users WHERE age > ?"},
+		{"array subscripts",
+			"SELECT tags[1], [name] FROM posts WHERE scores[?] > 1",
+			"select [name], tags [1] from posts where scores[$1] > 1"},
+		{"placeholder styles",
+			"SELECT id FROM users WHERE name = ? AND age > ?",
+			"SELECT id FROM users WHERE name = $1 AND age > $2"},
+		{"named placeholders",
+			"SELECT id FROM users WHERE name = :name",
+			"SELECT id FROM users WHERE name = @name"},
+		{"commutative AND",
+			"SELECT id FROM users WHERE age > 18 AND name = 'bob' AND active = 1",
+			"SELECT id FROM users WHERE active = 1 AND (name = 'bob' AND age > 18)"},
+		{"commutative OR inside AND",
+			"SELECT id FROM users WHERE (a = 1 OR b = 2) AND c = 3",
+			"SELECT id FROM users WHERE c = 3 AND (b = 2 OR a = 1)"},
+		{"between is not a conjunction",
+			"SELECT id FROM users WHERE age BETWEEN 18 AND 30 AND active = 1",
+			"SELECT id FROM users WHERE active = 1 AND age BETWEEN 18 AND 30"},
+		{"not equal operators",
+			"SELECT id FROM users WHERE status != 'deleted'",
+			"SELECT id FROM users WHERE status <> 'deleted'"},
+		{"comments",
+			"SELECT id /* primary key */ FROM users -- all users",
+			"SELECT id FROM users"},
+		{"aliases",
+			"SELECT u.id AS uid, u.name FROM users AS u",
+			"SELECT u.name, u.id uid FROM users u"},
+		{"join types and conditions",
+			"SELECT u.id, o.total FROM users u INNER JOIN orders o ON u.id = o.user_id AND o.status = ? LEFT OUTER JOIN refunds r ON r.order_id = o.id",
+			"SELECT o.total, u.id FROM users u JOIN orders o ON o.status = ? AND u.id = o.user_id LEFT JOIN refunds r ON r.order_id = o.id"},
+		{"group by and having",
+			"SELECT user_id, status, COUNT(*) FROM orders GROUP BY user_id, status HAVING COUNT(*) > 1 AND SUM(total) > 10",
+			"SELECT COUNT(*), status, user_id FROM orders GROUP BY status, user_id HAVING SUM(total) > 10 AND COUNT(*) > 1"},
+		{"order by default direction",
+			"SELECT id FROM users ORDER BY name ASC, id DESC LIMIT 10",
+			"SELECT id FROM users ORDER BY name, id DESC LIMIT 10"},
+		{"subquery",
+			"SELECT id FROM users WHERE id IN (SELECT user_id FROM orders WHERE total > 10 AND status = 'paid')",
+			"SELECT id FROM users WHERE id IN (select user_id from orders where status = 'paid' and total > 10)"},
+		{"union",
+			"SELECT id, name FROM users WHERE a = 1 AND b = 2 UNION ALL SELECT id, name FROM admins",
+			"select id, name from users where b = 2 and a = 1 union all select id, name from admins"},
+		{"insert column order",
+			"INSERT INTO users (name, age, active) VALUES (?, 18, ?), (?, 21, ?)",
+			"insert into `users` (`age`, `name`, `active`) values (18, $1, $2), (21, $3, $4)"},
+		{"insert returning",
+			"INSERT INTO users (name, age) VALUES ('bob', 18) RETURNING id",
+			"INSERT INTO users (age, name) VALUES (18, 'bob') RETURNING id"},
+		{"insert select",
+			"INSERT INTO archive (id, name) SELECT id, name FROM users WHERE deleted = 1 AND age > 60",
+			"insert into archive (id, name) select id, name from users where age > 60 and deleted = 1"},
+		{"update",
+			"UPDATE users SET active = 1, name = ?, age = ? WHERE deleted = 0 AND id = ? AND tenant = ?",
+			`UPDATE "users" SET active = 1, name = ?, age = ? WHERE id = ? AND tenant = ? AND deleted = 0`},
+		{"delete",
+			"DELETE FROM users WHERE age > 60 AND active = 0",
+			"delete from users where active = 0 and age > 60"},
+		{"with",
+			"WITH recent AS (SELECT id, user_id FROM orders WHERE created_at > ?) SELECT u.id, u.name FROM users u JOIN recent r ON r.user_id = u.id",
+			"with recent as (select id, user_id from orders where created_at > $1) select u.name, u.id from users u join recent r on r.user_id = u.id"},
+		{"case expression",
+			"SELECT CASE WHEN a = 1 AND b = 2 THEN 'x' ELSE 'y' END AS v, id FROM t",
+			"SELECT id, CASE WHEN a = 1 AND b = 2 THEN 'x' ELSE 'y' END v FROM t"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !CompareSQL(tt.sql1, tt.sql2) {
+				t.Errorf("expected equal:\n%s\n%s", canonicalSQL(tt.sql1), canonicalSQL(tt.sql2))
+			}
+		})
+	}
+}
+
+func TestCompareSQL_Different(t *testing.T) {
+	tests := []struct {
+		name string
+		sql1 string
+		sql2 string
+	}{
+		{"different table",
+			"SELECT id FROM users",
+			"SELECT id FROM admins"},
+		{"different condition",
+			"SELECT id FROM users WHERE age > 18",
+			"SELECT id FROM users WHERE age >= 18"},
+		{"and vs or",
+			"SELECT id FROM users WHERE a = 1 AND b = 2",
+			"SELECT id FROM users WHERE a = 1 OR b = 2"},
+		{"order by is ordered",
+			"SELECT id FROM users ORDER BY name, id",
+			"SELECT id FROM users ORDER BY id, name"},
+		{"order by direction",
+			"SELECT id FROM users ORDER BY name DESC",
+			"SELECT id FROM users ORDER BY name"},
+		{"string literal case",
+			"SELECT id FROM users WHERE name = 'Bob'",
+			"SELECT id FROM users WHERE name = 'bob'"},
+		{"join type",
+			"SELECT u.id FROM users u JOIN orders o ON o.user_id = u.id",
+			"SELECT u.id FROM users u LEFT JOIN orders o ON o.user_id = u.id"},
+		{"insert values swapped",
+			"INSERT INTO users (name, age) VALUES ('bob', 18)",
+			"INSERT INTO users (name, age) VALUES (18, 'bob')"},
+		{"update vs delete",
+			"UPDATE users SET active = 0 WHERE id = ?",
+			"DELETE FROM users WHERE id = ?"},
+		{"limit",
+			"SELECT id FROM users LIMIT 1",
+			"SELECT id FROM users LIMIT 2"},
+		{"distinct",
+			"SELECT DISTINCT id FROM users",
+			"SELECT id FROM users"},
+		{"array subscripts",
+			"SELECT tags[1] FROM posts WHERE (scores)[2] > 1",
+			"SELECT tags[2] FROM posts WHERE (scores)[2] > 1"},
+		{"update assignments with placeholders",
+			"UPDATE users SET name = ?, age = ? WHERE id = ?",
+			"UPDATE users SET age = ?, name = ? WHERE id = ?"},
+		{"and operands with placeholders",
+			"SELECT id FROM users WHERE a = ? AND b = ?",
+			"SELECT id FROM users WHERE b = ? AND a = ?"},
+		{"or operands with placeholders",
+			"SELECT id FROM users WHERE a = 1 AND (b = ? OR c = ?)",
+			"SELECT id FROM users WHERE (c = ? OR b = ?) AND a = 1"},
+		{"insert columns with placeholders",
+			"INSERT INTO t (a, b) VALUES (?, ?)",
+			"INSERT INTO t (b, a) VALUES (?, ?)"},
+		{"insert select columns",
+			"INSERT INTO archive (id, name) SELECT id, name FROM users",
+			"INSERT INTO archive (id, name) SELECT name, id FROM users"},
+		{"union columns",
+			"SELECT id, name FROM users UNION SELECT id, name FROM admins",
+			"SELECT name, id FROM users UNION SELECT name, id FROM admins"},
+		{"subquery columns",
+			"SELECT id FROM t WHERE (a, b) IN (SELECT a, b FROM u)",
+			"SELECT id FROM t WHERE (a, b) IN (SELECT b, a FROM u)"},
+		{"update assignments",
+			"UPDATE users SET a = b, b = a WHERE id = 1",
+			"UPDATE users SET b = a, a = b WHERE id = 1"},
+		{"select items with placeholders",
+			"SELECT ? AS x, ? AS y FROM t",
+			"SELECT ? AS y, ? AS x FROM t"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if CompareSQL(tt.sql1, tt.sql2) {
+				t.Errorf("expected different:\n%s\n%s", canonicalSQL(tt.sql1), canonicalSQL(tt.sql2))
+			}
+		})
+	}
+}
+
+func TestCanonicalSQL(t *testing.T) {
+	got := canonicalSQL("SELECT name, id FROM `users` WHERE age > $1 AND name LIKE 'a%' ORDER BY id ASC")
+	want := "select id, name from users where name like 'a%' and age > ? order by id"
+	if got != want {
+		t.Errorf("canonicalSQL() = %q, want %q", got, want)
+	}
+}
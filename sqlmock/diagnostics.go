@@ -0,0 +1,189 @@
+package sqlmock
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+)
+
+// closestQuery returns the expected query closest to query by the distance of their normalized SQL.
+// Expectations that were called their maximum number of times are only considered if all are.
+// The caller must hold m.mu.
+func (m *MockDB) closestQuery(query string) *ExpectedQuery {
+	var candidates, exhausted []*ExpectedQuery
+	for _, e := range m.expected {
+		eq, ok := e.(*ExpectedQuery)
+		if !ok {
+			continue
+		}
+		if eq.exhausted() {
+			exhausted = append(exhausted, eq)
+		} else {
+			candidates = append(candidates, eq)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = exhausted
+	}
+
+	actual := strings.Fields(canonicalSQL(query))
+
+	var closest *ExpectedQuery
+	best := -1
+	for _, eq := range candidates {
+		d := wordDistance(strings.Fields(eq.canonicalSQL()), actual)
+		if best < 0 || d < best {
+			closest, best = eq, d
+		}
+	}
+
+	return closest
+}
+
+// canonicalSQL returns the normalized SQL of the expectation, or the pattern for a regexp matcher.
+func (eq *ExpectedQuery) canonicalSQL() string {
+	if eq.matcher != nil {
+		return eq.matcher.String()
+	}
+	return canonicalSQL(eq.query)
+}
+
+// mismatchDetails explains why the query does not match the expectation eq.
+func mismatchDetails(eq *ExpectedQuery, query string, args []driver.NamedValue, inTx bool) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "\nclosest expectation: %s", eq)
+
+	actual := canonicalSQL(query)
+	if eq.matcher != nil {
+		if !eq.matcher.MatchString(query) {
+			fmt.Fprintf(&b, "\n  pattern:  %s\n  actual:   %s", eq.matcher, query)
+		}
+	} else if expected := eq.canonicalSQL(); expected != actual {
+		fmt.Fprintf(&b, "\n  expected: %s\n  actual:   %s\n  diff:     %s", expected, actual, diffWords(expected, actual))
+	}
+
+	for _, mismatch := range argsMismatches(eq.args, args) {
+		fmt.Fprintf(&b, "\n  %s", mismatch)
+	}
+
+	switch {
+	case eq.tx == txInside && !inTx:
+		b.WriteString("\n  expected to run inside a transaction")
+	case eq.tx == txOutside && inTx:
+		b.WriteString("\n  expected to run outside a transaction")
+	}
+
+	return b.String()
+}
+
+// argsMismatches describes every argument that does not match, with expected and actual values and types.
+func argsMismatches(expected []driver.Value, actual []driver.NamedValue) []string {
+	var mismatches []string
+
+	if len(expected) != len(actual) {
+		mismatches = append(mismatches, fmt.Sprintf("expected %d args, actual %d args", len(expected), len(actual)))
+	}
+
+	for i, e := range expected {
+		if named, ok := e.(sql.NamedArg); ok {
+			var found *driver.NamedValue
+			for j := range actual {
+				if actual[j].Name == named.Name {
+					found = &actual[j]
+					break
+				}
+			}
+
+			switch {
+			case found == nil:
+				mismatches = append(mismatches, fmt.Sprintf("arg %s: expected %s, missing", named.Name, formatValue(named.Value)))
+			case !matchValue(named.Value, found.Value):
+				mismatches = append(mismatches, fmt.Sprintf("arg %s: expected %s, actual %s", named.Name, formatValue(named.Value), formatValue(found.Value)))
+			}
+			continue
+		}
+
+		if i >= len(actual) {
+			mismatches = append(mismatches, fmt.Sprintf("arg %d: expected %s, missing", i, formatValue(e)))
+			continue
+		}
+		if !matchValue(e, actual[i].Value) {
+			mismatches = append(mismatches, fmt.Sprintf("arg %d: expected %s, actual %s", i, formatValue(e), formatValue(actual[i].Value)))
+		}
+	}
+
+	return mismatches
+}
+
+// formatValue formats a value with its type, matchers are formatted as is.
+func formatValue(v driver.Value) string {
+	if arg, ok := v.(Argument); ok {
+		return fmt.Sprintf("%v", arg)
+	}
+	return fmt.Sprintf("%#v (%T)", v, v)
+}
+
+// wordDistance returns the Levenshtein distance between two word lists.
+func wordDistance(a, b []string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
+
+// diffWords returns a word diff of two strings, removed words are shown as [-word-]
+// and added words as {+word+}.
+func diffWords(expected, actual string) string {
+	a, b := strings.Fields(expected), strings.Fields(actual)
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var words []string
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			words = append(words, a[i])
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			words = append(words, "[-"+a[i]+"-]")
+			i++
+		default:
+			words = append(words, "{+"+b[j]+"+}")
+			j++
+		}
+	}
+
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,84 @@
+package sqlmock
+
+import (
+	"database/sql/driver"
+	"strings"
+	"testing"
+)
+
+func TestMismatchError(t *testing.T) {
+	m := NewMock()
+	m.ExpectQuery("SELECT id, name FROM users WHERE id = ?", 1)
+	m.ExpectQuery("INSERT INTO users (name, age) VALUES (?, ?)", "Alice", 25)
+	m.ExpectQuery("DELETE FROM orders WHERE id = ?", 1)
+
+	db, err := m.Open("mock")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+
+	_, err = db.Exec("INSERT INTO users (name, age, email) VALUES (?, ?, ?)", "Alice", "25", "a@example.com")
+	if err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+
+	msg := err.Error()
+	for _, want := range []string{
+		"closest expectation: query 'INSERT INTO users (name, age) VALUES (?, ?)'",
+		"expected: insert into users (name, age) values (?, ?)",
+		"actual:   insert into users (name, age, email) values (?, ?, ?)",
+		"{+email)+}",
+		"expected 2 args, actual 3 args",
+		`arg 1: expected 25 (int), actual "25" (string)`,
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("expected %q in error:\n%s", want, msg)
+		}
+	}
+	if strings.Contains(msg, "arg 0") {
+		t.Errorf("unexpected mismatch of arg 0 in error:\n%s", msg)
+	}
+}
+
+func TestMismatchError_InTx(t *testing.T) {
+	m := NewMock()
+	m.ExpectQuery("DELETE FROM orders WHERE id = ?", 1).InTx()
+
+	db, err := m.Open("mock")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+
+	_, err = db.Exec("DELETE FROM orders WHERE id = ?", 1)
+	if err == nil || !strings.Contains(err.Error(), "expected to run inside a transaction") {
+		t.Errorf("expected transaction mismatch, got %v", err)
+	}
+}
+
+func TestArgsMismatches(t *testing.T) {
+	mismatches := argsMismatches(
+		[]driver.Value{AnyOfType[string](), int64(2)},
+		[]driver.NamedValue{{Ordinal: 1, Value: int64(1)}, {Ordinal: 2, Value: int64(2)}},
+	)
+	if len(mismatches) != 1 || mismatches[0] != "arg 0: expected AnyOfType[string](), actual 1 (int64)" {
+		t.Errorf("unexpected mismatches: %q", mismatches)
+	}
+}
+
+func TestDiffWords(t *testing.T) {
+	got := diffWords("select id, name from users", "select id from admins")
+	want := "select [-id,-] [-name-] {+id+} from [-users-] {+admins+}"
+	if got != want {
+		t.Errorf("diffWords() = %q, want %q", got, want)
+	}
+}
+
+func TestWordDistance(t *testing.T) {
+	a := strings.Fields("select id from users")
+	if d := wordDistance(a, a); d != 0 {
+		t.Errorf("expected distance 0, got %d", d)
+	}
+	if d := wordDistance(a, strings.Fields("select name from users where id = ?")); d != 5 {
+		t.Errorf("expected distance 5, got %d", d)
+	}
+}
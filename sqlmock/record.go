@@ -0,0 +1,655 @@
+package sqlmock
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	_ driver.Connector          = &Recorder{}
+	_ driver.Conn               = &recordingConn{}
+	_ driver.ConnBeginTx        = &recordingConn{}
+	_ driver.ConnPrepareContext = &recordingConn{}
+	_ driver.QueryerContext     = &recordingConn{}
+	_ driver.ExecerContext      = &recordingConn{}
+	_ driver.NamedValueChecker  = &recordingConn{}
+	_ driver.Pinger             = &recordingConn{}
+	_ driver.SessionResetter    = &recordingConn{}
+	_ driver.Validator          = &recordingConn{}
+	_ driver.Stmt               = &recordingStmt{}
+	_ driver.StmtQueryContext   = &recordingStmt{}
+	_ driver.StmtExecContext    = &recordingStmt{}
+	_ driver.Tx                 = &recordingTx{}
+)
+
+// record kinds
+const (
+	recordQuery    = "query"
+	recordExec     = "exec"
+	recordBegin    = "begin"
+	recordCommit   = "commit"
+	recordRollback = "rollback"
+	recordPrepare  = "prepare"
+)
+
+// record is a captured call, a golden file is a JSON array of records.
+type record struct {
+	Kind  string        `json:"kind"`
+	Query string        `json:"query,omitempty"`
+	Args  []recordedArg `json:"args,omitempty"`
+	InTx  bool          `json:"in_tx,omitempty"`
+	Error string        `json:"error,omitempty"`
+
+	// query results
+	Columns  []string          `json:"columns,omitempty"`
+	Rows     [][]recordedValue `json:"rows,omitempty"`
+	RowError string            `json:"row_error,omitempty"`
+	// NextSets are the result sets following the first one.
+	NextSets []recordedSet `json:"next_sets,omitempty"`
+
+	// exec results
+	LastInsertID    int64  `json:"last_insert_id,omitempty"`
+	RowsAffected    int64  `json:"rows_affected,omitempty"`
+	LastInsertIDErr string `json:"last_insert_id_error,omitempty"`
+	RowsAffectedErr string `json:"rows_affected_error,omitempty"`
+
+	// begin options
+	Isolation int  `json:"isolation,omitempty"`
+	ReadOnly  bool `json:"read_only,omitempty"`
+}
+
+// recordedSet is a result set following the first result set of a query.
+type recordedSet struct {
+	Columns  []string          `json:"columns,omitempty"`
+	Rows     [][]recordedValue `json:"rows,omitempty"`
+	RowError string            `json:"row_error,omitempty"`
+}
+
+type recordedArg struct {
+	Name  string        `json:"name,omitempty"`
+	Value recordedValue `json:"value"`
+}
+
+// recordedValue is a driver.Value which keeps its type in JSON.
+type recordedValue struct {
+	v driver.Value
+}
+
+type typedJSONValue struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+func (rv recordedValue) MarshalJSON() ([]byte, error) {
+	var typ string
+	var value any = rv.v
+
+	switch v := rv.v.(type) {
+	case nil:
+		return json.Marshal(typedJSONValue{Type: "null"})
+	case int64:
+		typ = "int64"
+	case float64:
+		typ = "float64"
+	case bool:
+		typ = "bool"
+	case string:
+		typ = "string"
+	case []byte:
+		typ, value = "bytes", base64.StdEncoding.EncodeToString(v)
+	case time.Time:
+		typ, value = "time", v.Format(time.RFC3339Nano)
+	default:
+		return nil, fmt.Errorf("can not record value of type %T", rv.v)
+	}
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(typedJSONValue{Type: typ, Value: raw})
+}
+
+func (rv *recordedValue) UnmarshalJSON(data []byte) error {
+	var tv typedJSONValue
+	if err := json.Unmarshal(data, &tv); err != nil {
+		return err
+	}
+
+	var err error
+	switch tv.Type {
+	case "null":
+		rv.v = nil
+	case "int64":
+		var v int64
+		err = json.Unmarshal(tv.Value, &v)
+		rv.v = v
+	case "float64":
+		var v float64
+		err = json.Unmarshal(tv.Value, &v)
+		rv.v = v
+	case "bool":
+		var v bool
+		err = json.Unmarshal(tv.Value, &v)
+		rv.v = v
+	case "string":
+		var v string
+		err = json.Unmarshal(tv.Value, &v)
+		rv.v = v
+	case "bytes":
+		var s string
+		if err = json.Unmarshal(tv.Value, &s); err == nil {
+			rv.v, err = base64.StdEncoding.DecodeString(s)
+		}
+	case "time":
+		var s string
+		if err = json.Unmarshal(tv.Value, &s); err == nil {
+			rv.v, err = time.Parse(time.RFC3339Nano, s)
+		}
+	default:
+		err = fmt.Errorf("unknown recorded value type %q", tv.Type)
+	}
+
+	return err
+}
+
+// Recorder is a driver.Connector which wraps a real connector and records every
+// query, its arguments, columns, rows and results.
+// The records can be saved to a golden file and loaded into a MockDB by Replay,
+// so fixtures captured against a real database become fast unit tests.
+type Recorder struct {
+	connector driver.Connector
+
+	mu      sync.Mutex
+	records []record
+}
+
+// NewRecorder creates a Recorder which wraps connector.
+func NewRecorder(connector driver.Connector) *Recorder {
+	return &Recorder{connector: connector}
+}
+
+// NewDriverRecorder creates a Recorder which opens connections by the driver d with the data source name dsn.
+func NewDriverRecorder(d driver.Driver, dsn string) (*Recorder, error) {
+	if dc, ok := d.(driver.DriverContext); ok {
+		connector, err := dc.OpenConnector(dsn)
+		if err != nil {
+			return nil, err
+		}
+		return NewRecorder(connector), nil
+	}
+
+	return NewRecorder(&dsnConnector{driver: d, dsn: dsn}), nil
+}
+
+// dsnConnector is a driver.Connector for drivers which do not implement driver.DriverContext.
+type dsnConnector struct {
+	driver driver.Driver
+	dsn    string
+}
+
+func (dc *dsnConnector) Connect(context.Context) (driver.Conn, error) {
+	return dc.driver.Open(dc.dsn)
+}
+
+func (dc *dsnConnector) Driver() driver.Driver {
+	return dc.driver
+}
+
+// Open opens a database which records every call through the recorder.
+func (r *Recorder) Open() *sql.DB {
+	return sql.OpenDB(r)
+}
+
+func (r *Recorder) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := r.connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &recordingConn{conn: conn, recorder: r}, nil
+}
+
+func (r *Recorder) Driver() driver.Driver {
+	return r.connector.Driver()
+}
+
+func (r *Recorder) add(rec record) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.records = append(r.records, rec)
+}
+
+// Save writes the records as JSON to w.
+func (r *Recorder) Save(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r.records)
+}
+
+// SaveFile writes the records as JSON to the golden file path.
+func (r *Recorder) SaveFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := r.Save(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Replay loads records saved by Recorder.Save and registers them as expectations in recorded order.
+// It enables strict mode, see MatchExpectationsInOrder, so the calls must be replayed in the recorded order.
+// Queries recorded inside a transaction are expected to run inside one, and vice versa.
+func (m *MockDB) Replay(r io.Reader) error {
+	var records []record
+	if err := json.NewDecoder(r).Decode(&records); err != nil {
+		return err
+	}
+
+	m.MatchExpectationsInOrder(true)
+	for _, rec := range records {
+		switch rec.Kind {
+		case recordQuery, recordExec:
+			m.replayQuery(rec)
+		case recordPrepare:
+			m.ExpectPrepare(rec.Query).WillReturnError(errors.New(rec.Error))
+		case recordBegin:
+			eb := m.ExpectBegin().WithTxOptions(sql.TxOptions{
+				Isolation: sql.IsolationLevel(rec.Isolation),
+				ReadOnly:  rec.ReadOnly,
+			})
+			if rec.Error != "" {
+				eb.WillReturnError(errors.New(rec.Error))
+			}
+		case recordCommit:
+			ec := m.ExpectCommit()
+			if rec.Error != "" {
+				ec.WillReturnError(errors.New(rec.Error))
+			}
+		case recordRollback:
+			er := m.ExpectRollback()
+			if rec.Error != "" {
+				er.WillReturnError(errors.New(rec.Error))
+			}
+		default:
+			return fmt.Errorf("unknown record kind %q", rec.Kind)
+		}
+	}
+
+	return nil
+}
+
+// ReplayFile loads the golden file path saved by Recorder.SaveFile, see Replay.
+func (m *MockDB) ReplayFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return m.Replay(f)
+}
+
+func (m *MockDB) replayQuery(rec record) {
+	args := make([]driver.Value, len(rec.Args))
+	for i, arg := range rec.Args {
+		if arg.Name != "" {
+			args[i] = sql.Named(arg.Name, arg.Value.v)
+		} else {
+			args[i] = arg.Value.v
+		}
+	}
+
+	eq := m.ExpectQuery(rec.Query, args...)
+	if rec.InTx {
+		eq.InTx()
+	} else {
+		eq.NotInTx()
+	}
+
+	if rec.Error != "" {
+		eq.WillReturnError(rec.Columns, errors.New(rec.Error))
+		return
+	}
+
+	if rec.Kind == recordExec {
+		eq.WillReturnResult(rec.LastInsertID, rec.RowsAffected)
+		if rec.LastInsertIDErr != "" {
+			eq.WillReturnLastInsertIdError(errors.New(rec.LastInsertIDErr))
+		}
+		if rec.RowsAffectedErr != "" {
+			eq.WillReturnRowsAffectedError(errors.New(rec.RowsAffectedErr))
+		}
+		return
+	}
+
+	sets := []*RowSet{replaySet(recordedSet{Columns: rec.Columns, Rows: rec.Rows, RowError: rec.RowError})}
+	for _, set := range rec.NextSets {
+		sets = append(sets, replaySet(set))
+	}
+	eq.WillReturnRowSets(sets...)
+}
+
+// replaySet returns the result set of a record, its row error is returned after its rows.
+func replaySet(set recordedSet) *RowSet {
+	rows := make([][]driver.Value, len(set.Rows))
+	for i, row := range set.Rows {
+		rows[i] = make([]driver.Value, len(row))
+		for j, v := range row {
+			rows[i][j] = v.v
+		}
+	}
+
+	rs := NewRowSet(set.Columns, rows)
+	if set.RowError != "" {
+		rs.err = errors.New(set.RowError)
+	}
+	return rs
+}
+
+// recordingConn wraps a real connection and records every call.
+type recordingConn struct {
+	conn     driver.Conn
+	recorder *Recorder
+	inTx     bool
+}
+
+func (rc *recordingConn) Prepare(query string) (driver.Stmt, error) {
+	return rc.PrepareContext(context.Background(), query)
+}
+
+func (rc *recordingConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var stmt driver.Stmt
+	var err error
+	if cp, ok := rc.conn.(driver.ConnPrepareContext); ok {
+		stmt, err = cp.PrepareContext(ctx, query)
+	} else {
+		stmt, err = rc.conn.Prepare(query)
+	}
+	if err != nil {
+		rc.recorder.add(record{Kind: recordPrepare, Query: query, InTx: rc.inTx, Error: err.Error()})
+		return nil, err
+	}
+
+	return &recordingStmt{stmt: stmt, conn: rc, query: query}, nil
+}
+
+func (rc *recordingConn) Close() error {
+	return rc.conn.Close()
+}
+
+func (rc *recordingConn) Begin() (driver.Tx, error) {
+	return rc.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (rc *recordingConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	var tx driver.Tx
+	var err error
+	if cb, ok := rc.conn.(driver.ConnBeginTx); ok {
+		tx, err = cb.BeginTx(ctx, opts)
+	} else {
+		tx, err = rc.conn.Begin()
+	}
+
+	rc.recorder.add(record{
+		Kind:      recordBegin,
+		Error:     errorString(err),
+		Isolation: int(opts.Isolation),
+		ReadOnly:  opts.ReadOnly,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rc.inTx = true
+	return &recordingTx{tx: tx, conn: rc}, nil
+}
+
+// CheckNamedValue delegates to the real connection so arguments are converted as the driver does.
+func (rc *recordingConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := rc.conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// Ping delegates to the real connection, if it is a driver.Pinger.
+func (rc *recordingConn) Ping(ctx context.Context) error {
+	if pinger, ok := rc.conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+// ResetSession delegates to the real connection, if it is a driver.SessionResetter.
+func (rc *recordingConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := rc.conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+// IsValid delegates to the real connection, if it is a driver.Validator.
+func (rc *recordingConn) IsValid() bool {
+	if validator, ok := rc.conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+func (rc *recordingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := rc.conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	rows, err := queryer.QueryContext(ctx, query, args)
+	if errors.Is(err, driver.ErrSkip) {
+		return nil, err
+	}
+	return rc.recordRows(query, args, rows, err)
+}
+
+func (rc *recordingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := rc.conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	result, err := execer.ExecContext(ctx, query, args)
+	if errors.Is(err, driver.ErrSkip) {
+		return nil, err
+	}
+	return rc.recordResult(query, args, result, err)
+}
+
+// recordRows reads all rows of every result set so they can be recorded, the returned rows replay them.
+func (rc *recordingConn) recordRows(query string, args []driver.NamedValue, rows driver.Rows, err error) (driver.Rows, error) {
+	rec := record{Kind: recordQuery, Query: query, Args: recordArgs(args), InTx: rc.inTx}
+	if err != nil {
+		rec.Error = err.Error()
+		rc.recorder.add(rec)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sets []*RowSet
+	for {
+		set, recorded := readSet(rows)
+		sets = append(sets, set)
+		if len(sets) == 1 {
+			rec.Columns, rec.Rows, rec.RowError = recorded.Columns, recorded.Rows, recorded.RowError
+		} else {
+			rec.NextSets = append(rec.NextSets, recorded)
+		}
+
+		next, ok := rows.(driver.RowsNextResultSet)
+		if set.err != nil || !ok || !next.HasNextResultSet() || next.NextResultSet() != nil {
+			break
+		}
+	}
+	rc.recorder.add(rec)
+
+	return &MockRows{sets: sets}, nil
+}
+
+// readSet reads the rows of the current result set, a row error ends the result set.
+func readSet(rows driver.Rows) (*RowSet, recordedSet) {
+	recorded := recordedSet{Columns: rows.Columns()}
+
+	var data [][]driver.Value
+	var rowErr error
+	for {
+		dest := make([]driver.Value, len(recorded.Columns))
+		if err := rows.Next(dest); err != nil {
+			if err != io.EOF {
+				rowErr = err
+				recorded.RowError = err.Error()
+			}
+			break
+		}
+
+		// drivers may reuse the buffers of []byte values
+		for i, v := range dest {
+			if b, ok := v.([]byte); ok {
+				dest[i] = append([]byte(nil), b...)
+			}
+		}
+		data = append(data, dest)
+
+		row := make([]recordedValue, len(dest))
+		for i, v := range dest {
+			row[i] = recordedValue{v: v}
+		}
+		recorded.Rows = append(recorded.Rows, row)
+	}
+
+	set := NewRowSet(recorded.Columns, data)
+	set.err = rowErr
+	return set, recorded
+}
+
+func (rc *recordingConn) recordResult(query string, args []driver.NamedValue, result driver.Result, err error) (driver.Result, error) {
+	rec := record{Kind: recordExec, Query: query, Args: recordArgs(args), InTx: rc.inTx}
+	if err != nil {
+		rec.Error = err.Error()
+		rc.recorder.add(rec)
+		return nil, err
+	}
+
+	mr := &MockResult{}
+	mr.lastInsertID, mr.lastInsertIDErr = result.LastInsertId()
+	mr.rowsAffected, mr.rowsAffectedErr = result.RowsAffected()
+
+	rec.LastInsertID, rec.LastInsertIDErr = mr.lastInsertID, errorString(mr.lastInsertIDErr)
+	rec.RowsAffected, rec.RowsAffectedErr = mr.rowsAffected, errorString(mr.rowsAffectedErr)
+	rc.recorder.add(rec)
+
+	return mr, nil
+}
+
+func recordArgs(args []driver.NamedValue) []recordedArg {
+	recorded := make([]recordedArg, len(args))
+	for i, arg := range args {
+		recorded[i] = recordedArg{Name: arg.Name, Value: recordedValue{v: arg.Value}}
+	}
+	return recorded
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// recordingStmt wraps a real statement and records every execution.
+type recordingStmt struct {
+	stmt  driver.Stmt
+	conn  *recordingConn
+	query string
+}
+
+func (rs *recordingStmt) Close() error {
+	return rs.stmt.Close()
+}
+
+func (rs *recordingStmt) NumInput() int {
+	return rs.stmt.NumInput()
+}
+
+func (rs *recordingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return rs.ExecContext(context.Background(), valuesToNamedValues(args))
+}
+
+func (rs *recordingStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return rs.QueryContext(context.Background(), valuesToNamedValues(args))
+}
+
+func (rs *recordingStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	var result driver.Result
+	var err error
+	if se, ok := rs.stmt.(driver.StmtExecContext); ok {
+		result, err = se.ExecContext(ctx, args)
+	} else {
+		result, err = rs.stmt.Exec(namedValuesToValues(args))
+	}
+
+	return rs.conn.recordResult(rs.query, args, result, err)
+}
+
+func (rs *recordingStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	var rows driver.Rows
+	var err error
+	if sq, ok := rs.stmt.(driver.StmtQueryContext); ok {
+		rows, err = sq.QueryContext(ctx, args)
+	} else {
+		rows, err = rs.stmt.Query(namedValuesToValues(args))
+	}
+
+	return rs.conn.recordRows(rs.query, args, rows, err)
+}
+
+// recordingTx wraps a real transaction and records its end.
+type recordingTx struct {
+	tx   driver.Tx
+	conn *recordingConn
+}
+
+func (rt *recordingTx) Commit() error {
+	err := rt.tx.Commit()
+	rt.conn.inTx = false
+	rt.conn.recorder.add(record{Kind: recordCommit, Error: errorString(err)})
+	return err
+}
+
+func (rt *recordingTx) Rollback() error {
+	err := rt.tx.Rollback()
+	rt.conn.inTx = false
+	rt.conn.recorder.add(record{Kind: recordRollback, Error: errorString(err)})
+	return err
+}
+
+func namedValuesToValues(args []driver.NamedValue) []driver.Value {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	return values
+}
@@ -0,0 +1,255 @@
+package sqlmock_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/smallnest/exp/db"
+	"github.com/smallnest/exp/sqlmock"
+)
+
+type person struct {
+	ID    int64  `db:"id"`
+	Name  string `db:"name"`
+	Photo []byte `db:"photo"`
+}
+
+// runPersons is the code under test, it runs against both the recorder and the replaying mock.
+func runPersons(t *testing.T, sqlDB *sql.DB) []person {
+	ctx := context.Background()
+
+	id, err := db.Insert(ctx, sqlDB, "INSERT INTO persons (name, photo) VALUES (?, ?)", "carol", []byte{0xff, 0x00})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if id != 3 {
+		t.Errorf("expected id 3, got %d", id)
+	}
+
+	if _, err := db.UpdateTx(ctx, sqlDB, "UPDATE persons SET name = ? WHERE id = ?", "bob", 2); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	persons, err := db.Rows[person](ctx, sqlDB, "SELECT id, name, photo FROM persons ORDER BY id")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return persons
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	dir := t.TempDir()
+	golden := filepath.Join(dir, "persons.json")
+
+	// 1. record against a real sqlite database
+	realDB, err := sql.Open("sqlite3", filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer realDB.Close()
+
+	_, err = realDB.Exec(`CREATE TABLE persons (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL, photo BLOB);
+		INSERT INTO persons (name) VALUES ('alice'), ('fred');`)
+	if err != nil {
+		t.Fatalf("failed to create schema: %v", err)
+	}
+
+	recorder, err := sqlmock.NewDriverRecorder(realDB.Driver(), filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("failed to create recorder: %v", err)
+	}
+	recordDB := recorder.Open()
+	defer recordDB.Close()
+
+	recorded := runPersons(t, recordDB)
+	if len(recorded) != 3 || recorded[1].Name != "bob" || !bytes.Equal(recorded[2].Photo, []byte{0xff, 0x00}) {
+		t.Fatalf("unexpected persons: %+v", recorded)
+	}
+
+	if err := recorder.SaveFile(golden); err != nil {
+		t.Fatalf("failed to save records: %v", err)
+	}
+
+	// 2. replay without the database
+	mockDB := sqlmock.NewMock()
+	mockDB.MatchExpectationsInOrder(true)
+	if err := mockDB.ReplayFile(golden); err != nil {
+		t.Fatalf("failed to replay records: %v", err)
+	}
+
+	replayDB, err := mockDB.Open("mock")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+
+	replayed := runPersons(t, replayDB)
+	if len(replayed) != len(recorded) {
+		t.Fatalf("expected %d persons, got %d", len(recorded), len(replayed))
+	}
+	for i := range recorded {
+		if recorded[i].ID != replayed[i].ID || recorded[i].Name != replayed[i].Name || !bytes.Equal(recorded[i].Photo, replayed[i].Photo) {
+			t.Errorf("unexpected person at index %d: %+v, want %+v", i, replayed[i], recorded[i])
+		}
+	}
+
+	if err := mockDB.ExpectationsWereMet(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestReplay_Error(t *testing.T) {
+	mockDB := sqlmock.NewMock()
+
+	golden := `[{"kind": "query", "query": "SELECT id FROM missing", "error": "no such table: missing"}]`
+	if err := mockDB.Replay(bytes.NewBufferString(golden)); err != nil {
+		t.Fatalf("failed to replay records: %v", err)
+	}
+
+	sqlDB, err := mockDB.Open("mock")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+
+	_, err = sqlDB.Query("SELECT id FROM missing")
+	if err == nil || err.Error() != "no such table: missing" {
+		t.Errorf("expected recorded error, got %v", err)
+	}
+
+	if err := mockDB.Replay(bytes.NewBufferString(`[{"kind": "unknown"}]`)); err == nil {
+		t.Errorf("expected error for unknown record kind, got nil")
+	}
+}
+
+func TestRecordAndReplay_ResultSetsAndPrepare(t *testing.T) {
+	source := sqlmock.NewMock()
+	source.ExpectQuery("CALL report()").WillReturnRowSets(
+		sqlmock.NewRowSet([]string{"name"}, [][]driver.Value{{"alice"}, {"bob"}}),
+		sqlmock.NewRowSet([]string{"total"}, [][]driver.Value{{int64(2)}}),
+	)
+	source.ExpectPrepare("SELECT nope").WillReturnError(errors.New("syntax error"))
+	sourceDB, err := source.Open("mock")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+
+	recorder, err := sqlmock.NewDriverRecorder(sourceDB.Driver(), "")
+	if err != nil {
+		t.Fatalf("failed to create recorder: %v", err)
+	}
+
+	run := func(sqlDB *sql.DB) {
+		t.Helper()
+
+		rows, err := sqlDB.Query("CALL report()")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var count int
+		for rows.Next() {
+			count++
+		}
+		if !rows.NextResultSet() || !rows.Next() {
+			t.Fatalf("expected a second result set: %v", rows.Err())
+		}
+		var total int64
+		if err := rows.Scan(&total); err != nil || total != 2 || count != 2 {
+			t.Errorf("unexpected result sets: %d rows, total %d, %v", count, total, err)
+		}
+		rows.Close()
+
+		if _, err := sqlDB.Prepare("SELECT nope"); err == nil || err.Error() != "syntax error" {
+			t.Errorf("expected prepare error, got %v", err)
+		}
+	}
+
+	recordDB := recorder.Open()
+	defer recordDB.Close()
+	run(recordDB)
+
+	var golden bytes.Buffer
+	if err := recorder.Save(&golden); err != nil {
+		t.Fatalf("failed to save records: %v", err)
+	}
+
+	mockDB := sqlmock.NewMock()
+	if err := mockDB.Replay(&golden); err != nil {
+		t.Fatalf("failed to replay records: %v", err)
+	}
+	replayDB, err := mockDB.Open("mock")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	run(replayDB)
+
+	if err := mockDB.ExpectationsWereMet(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestReplay_Ordered(t *testing.T) {
+	mockDB := sqlmock.NewMock()
+
+	golden := `[
+		{"kind": "exec", "query": "DELETE FROM orders", "rows_affected": 2},
+		{"kind": "exec", "query": "DELETE FROM users", "rows_affected": 1}
+	]`
+	if err := mockDB.Replay(bytes.NewBufferString(golden)); err != nil {
+		t.Fatalf("failed to replay records: %v", err)
+	}
+
+	sqlDB, err := mockDB.Open("mock")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+
+	if _, err := sqlDB.Exec("DELETE FROM users"); err == nil {
+		t.Errorf("expected error for a call out of the recorded order, got nil")
+	}
+}
+
+// pingConnector connects to a database which is down, its connections only answer pings.
+type pingConnector struct {
+	pings int
+}
+
+func (c *pingConnector) Connect(context.Context) (driver.Conn, error) { return &pingConn{c}, nil }
+func (c *pingConnector) Driver() driver.Driver                        { return nil }
+
+type pingConn struct {
+	connector *pingConnector
+}
+
+var errDown = errors.New("database is down")
+
+func (pc *pingConn) Prepare(string) (driver.Stmt, error) { return nil, errDown }
+func (pc *pingConn) Close() error                        { return nil }
+func (pc *pingConn) Begin() (driver.Tx, error)           { return nil, errDown }
+func (pc *pingConn) IsValid() bool                       { return false }
+
+func (pc *pingConn) Ping(context.Context) error {
+	pc.connector.pings++
+	return errDown
+}
+
+func TestRecorder_Ping(t *testing.T) {
+	connector := &pingConnector{}
+	recordDB := sqlmock.NewRecorder(connector).Open()
+	defer recordDB.Close()
+
+	// the pings reach the real connection
+	for range 2 {
+		if err := recordDB.Ping(); !errors.Is(err, errDown) {
+			t.Errorf("expected %v, got %v", errDown, err)
+		}
+	}
+	if connector.pings != 2 {
+		t.Errorf("expected 2 pings, got %d", connector.pings)
+	}
+}
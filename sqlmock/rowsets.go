@@ -0,0 +1,54 @@
+package sqlmock
+
+import (
+	"database/sql/driver"
+	"io"
+)
+
+var _ driver.RowsNextResultSet = &MockRows{}
+
+// RowSet is a result set returned by a query.
+type RowSet struct {
+	columns     []string
+	columnTypes []*Column
+	rows        [][]driver.Value
+	// err is returned after the rows, such as a recorded row error.
+	err error
+}
+
+// NewRowSet creates a result set with the columns and rows.
+func NewRowSet(columns []string, rows [][]driver.Value) *RowSet {
+	return &RowSet{columns: columns, rows: rows}
+}
+
+// NewRowSetWithColumns creates a result set with typed column definitions and rows.
+func NewRowSetWithColumns(columns []*Column, rows [][]driver.Value) *RowSet {
+	names := make([]string, len(columns))
+	for i, c := range columns {
+		names[i] = c.name
+	}
+
+	return &RowSet{columns: names, columnTypes: columns, rows: rows}
+}
+
+// WillReturnRowSets sets multiple result sets to be returned for the query,
+// such as those of a stored procedure or a batch of statements.
+// The next result set is read by rows.NextResultSet().
+func (eq *ExpectedQuery) WillReturnRowSets(sets ...*RowSet) *ExpectedQuery {
+	eq.sets = sets
+	return eq
+}
+
+func (mr *MockRows) HasNextResultSet() bool {
+	return mr.set+1 < len(mr.sets)
+}
+
+func (mr *MockRows) NextResultSet() error {
+	if !mr.HasNextResultSet() {
+		return io.EOF
+	}
+
+	mr.set++
+	mr.cursor = 0
+	return nil
+}
@@ -0,0 +1,114 @@
+package sqlmock_test
+
+import (
+	"database/sql/driver"
+	"testing"
+
+	"github.com/smallnest/exp/sqlmock"
+)
+
+func TestWillReturnRowSets(t *testing.T) {
+	mockDB := sqlmock.NewMock()
+
+	mockDB.ExpectQuery("CALL user_report()").
+		WillReturnRowSets(
+			sqlmock.NewRowSet([]string{"id", "name"}, [][]driver.Value{
+				{int64(1), "alice"},
+				{int64(2), "bob"},
+			}),
+			sqlmock.NewRowSetWithColumns([]*sqlmock.Column{
+				sqlmock.NewColumn("total").OfType("BIGINT", int64(0)),
+			}, [][]driver.Value{
+				{int64(2)},
+			}),
+		)
+
+	sqlDB, err := mockDB.Open("mock")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+
+	rows, err := sqlDB.Query("CALL user_report()")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var id int64
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		names = append(names, name)
+	}
+	if len(names) != 2 || names[0] != "alice" || names[1] != "bob" {
+		t.Errorf("unexpected names in the first result set: %v", names)
+	}
+
+	if !rows.NextResultSet() {
+		t.Fatalf("expected a second result set: %v", rows.Err())
+	}
+
+	columns, err := rows.Columns()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(columns) != 1 || columns[0] != "total" {
+		t.Errorf("unexpected columns in the second result set: %v", columns)
+	}
+
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if types[0].DatabaseTypeName() != "BIGINT" {
+		t.Errorf("expected BIGINT, got %s", types[0].DatabaseTypeName())
+	}
+
+	if !rows.Next() {
+		t.Fatalf("expected a row in the second result set: %v", rows.Err())
+	}
+	var total int64
+	if err := rows.Scan(&total); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if total != 2 {
+		t.Errorf("expected total 2, got %d", total)
+	}
+	if rows.Next() {
+		t.Errorf("expected no more rows")
+	}
+
+	if rows.NextResultSet() {
+		t.Errorf("expected no more result sets")
+	}
+	if err := rows.Err(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestWillReturnRows_SingleResultSet(t *testing.T) {
+	mockDB := sqlmock.NewMock()
+
+	mockDB.ExpectQuery("SELECT id FROM users").
+		WillReturnRows([]string{"id"}, [][]driver.Value{{1}})
+
+	sqlDB, err := mockDB.Open("mock")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+
+	rows, err := sqlDB.Query("SELECT id FROM users")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+	}
+	if rows.NextResultSet() {
+		t.Errorf("expected a single result set")
+	}
+}
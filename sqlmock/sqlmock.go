@@ -1,48 +1,142 @@
 package sqlmock
 
 import (
-	"bytes"
 	"context"
 	"database/sql"
 	"database/sql/driver"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"regexp"
 	"sync"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
 )
 
+// errNoExpectation is returned by find when no expectation matches in unordered mode.
+var errNoExpectation = errors.New("no matching expectation")
+
 var (
-	_ driver.Connector = &MockConnector{}
-	_ driver.Driver    = &MockDriver{}
-	_ driver.Conn      = &MockConn{}
-	_ driver.Stmt      = &MockStmt{}
-	_ driver.Result    = &MockResult{}
-	_ driver.Rows      = &MockRows{}
-	_ driver.Tx        = &MockTx{}
+	_ driver.Connector   = &MockConnector{}
+	_ driver.Driver      = &MockDriver{}
+	_ driver.Conn        = &MockConn{}
+	_ driver.ConnBeginTx = &MockConn{}
+	_ driver.Stmt        = &MockStmt{}
+
+	_ driver.QueryerContext     = &MockConn{}
+	_ driver.ExecerContext      = &MockConn{}
+	_ driver.ConnPrepareContext = &MockConn{}
+	_ driver.NamedValueChecker  = &MockConn{}
+	_ driver.Pinger             = &MockConn{}
+	_ driver.StmtQueryContext   = &MockStmt{}
+	_ driver.StmtExecContext    = &MockStmt{}
+
+	_ driver.Result = &MockResult{}
+	_ driver.Rows   = &MockRows{}
+	_ driver.Tx     = &MockTx{}
+)
+
+// expectation is implemented by every kind of expected call, such as queries and transaction operations.
+type expectation interface {
+	fmt.Stringer
+
+	exhausted() bool
+	satisfied() bool
+	overCalled() bool
+	timesString() string
+	calls() int
+	called()
+}
+
+// commonExpectation holds the call bounds shared by all expectations.
+type commonExpectation struct {
+	// minTimes and maxTimes bound how many calls satisfy the expectation,
+	// maxTimes < 0 means no upper bound.
+	minTimes int
+	maxTimes int
+
+	CallCount int
+}
+
+func newCommonExpectation() commonExpectation {
+	return commonExpectation{minTimes: 1, maxTimes: 1}
+}
+
+func (ce *commonExpectation) timesString() string {
+	switch {
+	case ce.maxTimes < 0:
+		return fmt.Sprintf("at least %d times", ce.minTimes)
+	case ce.minTimes == ce.maxTimes:
+		return fmt.Sprintf("exactly %d times", ce.minTimes)
+	default:
+		return fmt.Sprintf("between %d and %d times", ce.minTimes, ce.maxTimes)
+	}
+}
+
+// exhausted reports whether the expectation has been called its maximum number of times.
+func (ce *commonExpectation) exhausted() bool {
+	return ce.maxTimes >= 0 && ce.CallCount >= ce.maxTimes
+}
+
+// satisfied reports whether the expectation has been called its minimum number of times.
+func (ce *commonExpectation) satisfied() bool {
+	return ce.CallCount >= ce.minTimes
+}
+
+// overCalled reports whether the expectation has been called more than its maximum number of times.
+func (ce *commonExpectation) overCalled() bool {
+	return ce.maxTimes >= 0 && ce.CallCount > ce.maxTimes
+}
+
+func (ce *commonExpectation) calls() int {
+	return ce.CallCount
+}
+
+func (ce *commonExpectation) called() {
+	ce.CallCount++
+}
+
+// txState restricts whether a query must run inside or outside a transaction.
+type txState int
+
+const (
+	txAny txState = iota
+	txInside
+	txOutside
 )
 
 // ExpectedQuery represents an expected query
 type ExpectedQuery struct {
+	commonExpectation
+
 	query   string
 	matcher *regexp.Regexp
 	args    []driver.Value
-	rows    [][]driver.Value
-	columns []string
+	sets    []*RowSet
 	err     error
+	tx      txState
 
-	CallCount int
+	result    MockResult
+	rowErrors map[int]error
+	closeErr  error
+	delay     time.Duration
+
+	// TxCallCount is the number of calls which ran inside a transaction.
+	TxCallCount int
 }
 
 // MockDB simulates a database connection
 type MockDB struct {
 	mu       sync.Mutex
-	expected []*ExpectedQuery
+	expected []expectation
+	ordered  bool
 }
 
 // NewMock creates a new mock database
 func NewMock() *MockDB {
 	return &MockDB{
-		expected: []*ExpectedQuery{},
+		expected: []expectation{},
 	}
 }
 
@@ -52,8 +146,9 @@ func (m *MockDB) ExpectQuery(query string, args ...driver.Value) *ExpectedQuery
 	defer m.mu.Unlock()
 
 	eq := &ExpectedQuery{
-		query: query,
-		args:  args,
+		commonExpectation: newCommonExpectation(),
+		query:             query,
+		args:              args,
 	}
 	m.expected = append(m.expected, eq)
 	return eq
@@ -65,29 +160,154 @@ func (m *MockDB) Match(matcher string, args ...driver.Value) *ExpectedQuery {
 	defer m.mu.Unlock()
 
 	eq := &ExpectedQuery{
-		args:    args,
-		matcher: regexp.MustCompile(matcher),
+		commonExpectation: newCommonExpectation(),
+		args:              args,
+		matcher:           regexp.MustCompile(matcher),
 	}
 	m.expected = append(m.expected, eq)
 	return eq
 }
 
+// MatchExpectationsInOrder enables or disables strict mode.
+// In strict mode expectations must be satisfied in the order they were declared,
+// an expectation is consumed once it has been called its maximum number of times.
+// It is disabled by default, which matches any registered expectation in any order.
+func (m *MockDB) MatchExpectationsInOrder(ordered bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.ordered = ordered
+}
+
+// ExpectationsWereMet checks whether all expectations were called the expected number of times.
+// It reports every unmet or over-called expectation.
+func (m *MockDB) ExpectationsWereMet() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var errs *multierror.Error
+	for _, expected := range m.expected {
+		if !expected.satisfied() || expected.overCalled() {
+			errs = multierror.Append(errs, fmt.Errorf("%s: expected to be called %s, but called %d times", expected, expected.timesString(), expected.calls()))
+		}
+	}
+
+	return errs.ErrorOrNil()
+}
+
+// WithArgs sets the arguments the query is expected to be called with.
+// An argument can be a value, an Argument matcher or a sql.NamedArg created by sql.Named.
 func (eq *ExpectedQuery) WithArgs(args ...driver.Value) *ExpectedQuery {
 	eq.args = args
 	return eq
 }
 
+// Times sets the exact number of times the query is expected to be called.
+func (eq *ExpectedQuery) Times(n int) *ExpectedQuery {
+	eq.minTimes = n
+	eq.maxTimes = n
+	return eq
+}
+
+// Maybe marks the query as optional, it may be called at most once.
+func (eq *ExpectedQuery) Maybe() *ExpectedQuery {
+	eq.minTimes = 0
+	eq.maxTimes = 1
+	return eq
+}
+
+// AnyTimes allows the query to be called any number of times, including zero.
+func (eq *ExpectedQuery) AnyTimes() *ExpectedQuery {
+	eq.minTimes = 0
+	eq.maxTimes = -1
+	return eq
+}
+
+// String returns a description of the expected query with its arguments.
+func (eq *ExpectedQuery) String() string {
+	if eq.matcher != nil {
+		return fmt.Sprintf("query matching '%s' with args %v", eq.matcher, eq.args)
+	}
+	return fmt.Sprintf("query '%s' with args %v", eq.query, eq.args)
+}
+
+// InTx requires the query to run inside a transaction.
+func (eq *ExpectedQuery) InTx() *ExpectedQuery {
+	eq.tx = txInside
+	return eq
+}
+
+// NotInTx requires the query to run outside any transaction.
+func (eq *ExpectedQuery) NotInTx() *ExpectedQuery {
+	eq.tx = txOutside
+	return eq
+}
+
+// matches reports whether the query and arguments match the expectation.
+func (eq *ExpectedQuery) matches(query string, args []driver.NamedValue, inTx bool) bool {
+	if (eq.tx == txInside && !inTx) || (eq.tx == txOutside && inTx) {
+		return false
+	}
+
+	if eq.matcher != nil {
+		return eq.matcher.MatchString(query) && matchArgs(eq.args, args)
+	}
+	return CompareSQL(eq.query, query) && matchArgs(eq.args, args)
+}
+
 // WillReturnRows sets the rows to be returned for the query
 func (eq *ExpectedQuery) WillReturnRows(columns []string, rows [][]driver.Value) *ExpectedQuery {
-	eq.rows = rows
-	eq.columns = columns
+	eq.sets = []*RowSet{NewRowSet(columns, rows)}
 	return eq
 }
 
 // WillReturnError sets the error to be returned for the query
 func (eq *ExpectedQuery) WillReturnError(columns []string, err error) *ExpectedQuery {
 	eq.err = err
-	eq.columns = columns
+	eq.sets = []*RowSet{NewRowSet(columns, nil)}
+	return eq
+}
+
+// WillReturnResult sets the last insert id and the number of affected rows returned by Exec.
+func (eq *ExpectedQuery) WillReturnResult(lastInsertID, rowsAffected int64) *ExpectedQuery {
+	eq.result.lastInsertID = lastInsertID
+	eq.result.rowsAffected = rowsAffected
+	return eq
+}
+
+// WillReturnLastInsertIdError makes LastInsertId of the Exec result return err.
+func (eq *ExpectedQuery) WillReturnLastInsertIdError(err error) *ExpectedQuery {
+	eq.result.lastInsertIDErr = err
+	return eq
+}
+
+// WillReturnRowsAffectedError makes RowsAffected of the Exec result return err.
+func (eq *ExpectedQuery) WillReturnRowsAffectedError(err error) *ExpectedQuery {
+	eq.result.rowsAffectedErr = err
+	return eq
+}
+
+// WillReturnRowError makes reading the row at index row (starting from 0) fail with err,
+// rows before it are returned normally and the error is surfaced via rows.Err().
+// With multiple result sets, it applies to the first one.
+func (eq *ExpectedQuery) WillReturnRowError(row int, err error) *ExpectedQuery {
+	if eq.rowErrors == nil {
+		eq.rowErrors = make(map[int]error)
+	}
+	eq.rowErrors[row] = err
+	return eq
+}
+
+// WillReturnCloseError makes closing the returned rows fail with err.
+func (eq *ExpectedQuery) WillReturnCloseError(err error) *ExpectedQuery {
+	eq.closeErr = err
+	return eq
+}
+
+// WillDelayFor delays the query for d, the query returns the context error if
+// its context is done before the delay elapses.
+func (eq *ExpectedQuery) WillDelayFor(d time.Duration) *ExpectedQuery {
+	eq.delay = d
 	return eq
 }
 
@@ -122,11 +342,28 @@ func (md *MockDriver) Open(name string) (driver.Conn, error) {
 // MockConn implements the driver.Conn interface
 type MockConn struct {
 	mockDB *MockDB
+	tx     *MockTx // current transaction, nil if none
 }
 
 func (mc *MockConn) Prepare(query string) (driver.Stmt, error) {
+	return mc.PrepareContext(context.Background(), query)
+}
+
+func (mc *MockConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	mc.mockDB.mu.Lock()
+	expected := mc.mockDB.findPrepare(query)
+	mc.mockDB.mu.Unlock()
+	if expected != nil && expected.err != nil {
+		return nil, expected.err
+	}
+
 	return &MockStmt{
 		mockDB: mc.mockDB,
+		conn:   mc,
 		query:  query,
 	}, nil
 }
@@ -135,13 +372,127 @@ func (mc *MockConn) Close() error {
 	return nil
 }
 
-func (mc *MockConn) Begin() (driver.Tx, error) {
-	return &MockTx{}, nil
+// Ping implements driver.Pinger, it only fails if ctx is done.
+func (mc *MockConn) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// CheckNamedValue implements driver.NamedValueChecker.
+// Values are converted by the default converter when possible,
+// other values are passed as is so they can still be matched against expectations.
+func (mc *MockConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if v, err := driver.DefaultParameterConverter.ConvertValue(nv.Value); err == nil {
+		nv.Value = v
+	}
+	return nil
+}
+
+func (mc *MockConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	expected, err := mc.expect(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	result := expected.result
+	return &result, nil
+}
+
+func (mc *MockConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	expected, err := mc.expect(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MockRows{
+		sets:      expected.sets,
+		rowErrors: expected.rowErrors,
+		closeErr:  expected.closeErr,
+	}, nil
+}
+
+// expect finds the expectation for the query, waits for its delay and returns its error if any.
+// The mock lock is not held while waiting, so other connections are not blocked.
+func (mc *MockConn) expect(ctx context.Context, query string, args []driver.NamedValue) (*ExpectedQuery, error) {
+	mc.mockDB.mu.Lock()
+	expected, err := mc.mockDB.findQuery(query, args, mc.tx != nil)
+	mc.mockDB.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if expected.delay > 0 {
+		timer := time.NewTimer(expected.delay)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	if expected.err != nil {
+		return nil, expected.err
+	}
+
+	return expected, nil
+}
+
+// ExpectedPrepare represents an expected statement preparation
+type ExpectedPrepare struct {
+	commonExpectation
+
+	query string
+	err   error
+}
+
+// ExpectPrepare expects a statement to be prepared.
+//
+// Prepares that match no expectation succeed, also in strict mode,
+// so tests that do not care about prepared statements need not declare them.
+func (m *MockDB) ExpectPrepare(query string) *ExpectedPrepare {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ep := &ExpectedPrepare{commonExpectation: newCommonExpectation(), query: query}
+	m.expected = append(m.expected, ep)
+	return ep
+}
+
+// WillReturnError sets the error to be returned when the statement is prepared
+func (ep *ExpectedPrepare) WillReturnError(err error) *ExpectedPrepare {
+	ep.err = err
+	return ep
+}
+
+func (ep *ExpectedPrepare) String() string {
+	return fmt.Sprintf("prepare '%s'", ep.query)
+}
+
+// findPrepare returns the prepare expectation matching the query and records the call, nil if there is none.
+// In strict mode only the next expectation may match. The caller must hold m.mu.
+func (m *MockDB) findPrepare(query string) *ExpectedPrepare {
+	for _, expected := range m.expected {
+		if expected.exhausted() {
+			continue
+		}
+
+		if ep, ok := expected.(*ExpectedPrepare); ok && CompareSQL(ep.query, query) {
+			ep.called()
+			return ep
+		}
+
+		if m.ordered && !expected.satisfied() {
+			return nil
+		}
+	}
+	return nil
 }
 
 // MockStmt implements the driver.Stmt interface
 type MockStmt struct {
 	mockDB *MockDB
+	conn   *MockConn
 	query  string
 }
 
@@ -154,128 +505,161 @@ func (ms *MockStmt) NumInput() int {
 }
 
 func (ms *MockStmt) Exec(args []driver.Value) (driver.Result, error) {
-	ms.mockDB.mu.Lock()
-	defer ms.mockDB.mu.Unlock()
-
-	for i, expected := range ms.mockDB.expected {
-		if expected.matcher != nil && expected.matcher.MatchString(ms.query) && matchArgs(ms.mockDB.expected[i].args, args) {
-			// ms.mockDB.expected = append(ms.mockDB.expected[:i], ms.mockDB.expected[i+1:]...)
-			expected.CallCount++
-
-			if expected.err != nil {
-				return nil, expected.err
-			}
+	return ms.ExecContext(context.Background(), valuesToNamedValues(args))
+}
 
-			return &MockResult{}, nil
-		}
+func (ms *MockStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return ms.QueryContext(context.Background(), valuesToNamedValues(args))
+}
 
-		if CompareSQL(expected.query, ms.query) && matchArgs(expected.args, args) {
-			// ms.mockDB.expected = append(ms.mockDB.expected[:i], ms.mockDB.expected[i+1:]...)
-			expected.CallCount++
+func (ms *MockStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return ms.conn.ExecContext(ctx, ms.query, args)
+}
 
-			if expected.err != nil {
-				return nil, expected.err
-			}
+func (ms *MockStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return ms.conn.QueryContext(ctx, ms.query, args)
+}
 
-			return &MockResult{}, nil
+// findQuery returns the expected query matching the query and records the call.
+// The caller must hold m.mu.
+func (m *MockDB) findQuery(query string, args []driver.NamedValue, inTx bool) (*ExpectedQuery, error) {
+	expected, err := m.find(func(e expectation) bool {
+		eq, ok := e.(*ExpectedQuery)
+		return ok && eq.matches(query, args, inTx)
+	})
+	if err != nil {
+		var details string
+		if closest := m.closestQuery(query); closest != nil {
+			details = mismatchDetails(closest, query, args, inTx)
 		}
+		return nil, fmt.Errorf("unexpected query: %s with args %s, %w%s", query, formatArgs(args), err, details)
 	}
 
-	return nil, fmt.Errorf("unexpected query: %s", ms.query)
+	eq := expected.(*ExpectedQuery)
+	if inTx {
+		eq.TxCallCount++
+	}
+	return eq, nil
 }
 
-func (ms *MockStmt) Query(args []driver.Value) (driver.Rows, error) {
-	ms.mockDB.mu.Lock()
-	defer ms.mockDB.mu.Unlock()
-
-	for i, expected := range ms.mockDB.expected {
-		if expected.matcher != nil && expected.matcher.MatchString(ms.query) && matchArgs(ms.mockDB.expected[i].args, args) {
-			// ms.mockDB.expected = append(ms.mockDB.expected[:i], ms.mockDB.expected[i+1:]...)
-			expected.CallCount++
+// find returns the first expectation accepted by match and records the call.
+// The caller must hold m.mu.
+func (m *MockDB) find(match func(expectation) bool) (expectation, error) {
+	if m.ordered {
+		for _, expected := range m.expected {
+			if expected.exhausted() {
+				continue
+			}
 
-			if expected.err != nil {
-				return nil, expected.err
+			if match(expected) {
+				expected.called()
+				return expected, nil
 			}
 
-			return &MockRows{columns: expected.columns, rows: expected.rows}, nil
+			// an unsatisfied expectation must be met before the next one
+			if !expected.satisfied() {
+				return nil, fmt.Errorf("next expected %s", expected)
+			}
 		}
 
-		if CompareSQL(expected.query, ms.query) && matchArgs(expected.args, args) {
-			// ms.mockDB.expected = append(ms.mockDB.expected[:i], ms.mockDB.expected[i+1:]...)
-			expected.CallCount++
+		return nil, errors.New("all expectations were already fulfilled")
+	}
 
-			if expected.err != nil {
-				return nil, expected.err
-			}
+	// prefer an expectation that still has calls left,
+	// otherwise fall back to the first match and let ExpectationsWereMet report it
+	var fallback expectation
+	for _, expected := range m.expected {
+		if !match(expected) {
+			continue
+		}
 
-			return &MockRows{columns: expected.columns, rows: expected.rows}, nil
+		if !expected.exhausted() {
+			expected.called()
+			return expected, nil
+		}
+
+		if fallback == nil {
+			fallback = expected
 		}
 	}
 
-	return nil, fmt.Errorf("unexpected query: %s", ms.query)
+	if fallback != nil {
+		fallback.called()
+		return fallback, nil
+	}
+
+	return nil, errNoExpectation
 }
 
 // MockResult implements the driver.Result interface
-type MockResult struct{}
+type MockResult struct {
+	lastInsertID    int64
+	rowsAffected    int64
+	lastInsertIDErr error
+	rowsAffectedErr error
+}
 
 func (mr *MockResult) LastInsertId() (int64, error) {
-	return 0, nil
+	if mr.lastInsertIDErr != nil {
+		return 0, mr.lastInsertIDErr
+	}
+	return mr.lastInsertID, nil
 }
 
 func (mr *MockResult) RowsAffected() (int64, error) {
-	return 0, nil
+	if mr.rowsAffectedErr != nil {
+		return 0, mr.rowsAffectedErr
+	}
+	return mr.rowsAffected, nil
 }
 
 // MockRows implements the driver.Rows interface
 type MockRows struct {
-	rows    [][]driver.Value
-	columns []string
-	cursor  int
+	sets      []*RowSet
+	set       int // index of the current result set
+	cursor    int
+	rowErrors map[int]error
+	closeErr  error
+}
+
+// current returns the current result set, an empty one if the query returns no rows.
+func (mr *MockRows) current() *RowSet {
+	if mr.set < len(mr.sets) {
+		return mr.sets[mr.set]
+	}
+	return &RowSet{}
 }
 
 func (mr *MockRows) Columns() []string {
-	return mr.columns
+	return mr.current().columns
 }
 
 func (mr *MockRows) Close() error {
-	return nil
+	return mr.closeErr
 }
 
 func (mr *MockRows) Next(dest []driver.Value) error {
-	if mr.cursor >= len(mr.rows) {
-		return sql.ErrNoRows
+	if err, ok := mr.rowErrors[mr.cursor]; ok && mr.set == 0 {
+		return err
 	}
 
-	copy(dest, mr.rows[mr.cursor])
-	mr.cursor++
-	return nil
-}
-
-// MockTx implements the driver.Tx interface
-type MockTx struct{}
-
-func (mt *MockTx) Commit() error {
-	return nil
-}
+	set := mr.current()
+	if mr.cursor >= len(set.rows) {
+		if set.err != nil {
+			return set.err
+		}
+		return io.EOF
+	}
 
-func (mt *MockTx) Rollback() error {
+	copy(dest, set.rows[mr.cursor])
+	mr.cursor++
 	return nil
 }
 
-// Helper function: match query arguments
-func matchArgs(expected, actual []driver.Value) bool {
-	if len(expected) != len(actual) {
-		return false
+func valuesToNamedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
 	}
-
-	for i := range expected {
-		a, _ := json.Marshal(expected[i])
-		b, _ := json.Marshal(actual[i])
-
-		if !bytes.Equal(a, b) {
-			return false
-		}
-	}
-
-	return true
+	return named
 }
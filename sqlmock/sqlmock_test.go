@@ -1,10 +1,15 @@
 package sqlmock_test
 
 import (
+	"context"
 	"database/sql"
 	"database/sql/driver"
+	"errors"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/smallnest/exp/db"
 	"github.com/smallnest/exp/sqlmock"
 )
 
@@ -274,3 +279,314 @@ func TestMockDB_Match_NoMatch(t *testing.T) {
 		t.Fatalf("expected error, got nil")
 	}
 }
+
+func TestMockDB_MatchExpectationsInOrder(t *testing.T) {
+	mockDB := sqlmock.NewMock()
+	mockDB.MatchExpectationsInOrder(true)
+
+	mockDB.ExpectQuery("SELECT id, name, age FROM users WHERE id = ?").
+		WithArgs(1).
+		WillReturnRows([]string{"id", "name", "age"}, [][]driver.Value{
+			{1, "John Doe", 30},
+		})
+	mockDB.ExpectQuery("INSERT INTO users (name, age) VALUES (?, ?)", "Alice", 25)
+
+	db, err := mockDB.Open("mock")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	repo := &UserRepository{db: db}
+
+	// the insert is declared after the select, so it must not match first
+	if err := repo.CreateUser(User{Name: "Alice", Age: 25}); err == nil {
+		t.Fatalf("expected error for out of order query, got nil")
+	}
+
+	if _, err := repo.GetUserByID(1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := repo.CreateUser(User{Name: "Alice", Age: 25}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the select has been consumed
+	if _, err := repo.GetUserByID(1); err == nil {
+		t.Fatalf("expected error for consumed expectation, got nil")
+	}
+
+	if err := mockDB.ExpectationsWereMet(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestMockDB_Times(t *testing.T) {
+	mockDB := sqlmock.NewMock()
+	mockDB.MatchExpectationsInOrder(true)
+
+	mockDB.ExpectQuery("INSERT INTO users (name, age) VALUES (?, ?)", "Alice", 25).Times(2)
+	mockDB.ExpectQuery("SELECT id, name, age FROM users WHERE id = ?", 1).Maybe()
+	mockDB.ExpectQuery("INSERT INTO users (name, age) VALUES (?, ?)", "Bob", 30).AnyTimes()
+
+	db, err := mockDB.Open("mock")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	repo := &UserRepository{db: db}
+
+	for i := 0; i < 2; i++ {
+		if err := repo.CreateUser(User{Name: "Alice", Age: 25}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	// the optional select is skipped
+	for i := 0; i < 3; i++ {
+		if err := repo.CreateUser(User{Name: "Bob", Age: 30}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if err := mockDB.ExpectationsWereMet(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestMockDB_ExpectationsWereMet(t *testing.T) {
+	mockDB := sqlmock.NewMock()
+
+	mockDB.ExpectQuery("SELECT id, name, age FROM users WHERE id = ?", 1).
+		WillReturnRows([]string{"id", "name", "age"}, [][]driver.Value{
+			{1, "John Doe", 30},
+		})
+	mockDB.ExpectQuery("INSERT INTO users (name, age) VALUES (?, ?)", "Alice", 25).Times(2)
+
+	db, err := mockDB.Open("mock")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	repo := &UserRepository{db: db}
+
+	// without strict mode the select may be called more times than expected
+	for i := 0; i < 2; i++ {
+		if _, err := repo.GetUserByID(1); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := repo.CreateUser(User{Name: "Alice", Age: 25}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = mockDB.ExpectationsWereMet()
+	if err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+
+	msg := err.Error()
+	if !strings.Contains(msg, "SELECT id, name, age FROM users WHERE id = ?") || !strings.Contains(msg, "called 2 times") {
+		t.Errorf("expected over-called select in error, got %v", msg)
+	}
+	if !strings.Contains(msg, "INSERT INTO users") || !strings.Contains(msg, "[Alice 25]") || !strings.Contains(msg, "called 1 times") {
+		t.Errorf("expected unmet insert in error, got %v", msg)
+	}
+}
+
+func TestMockDB_WillReturnResult(t *testing.T) {
+	mockDB := sqlmock.NewMock()
+
+	mockDB.ExpectQuery("INSERT INTO users (name, age) VALUES (?, ?)", "Alice", 25).
+		WillReturnResult(42, 1)
+	mockDB.ExpectQuery("DELETE FROM users WHERE age > ?", 60).
+		WillReturnResult(0, 3)
+
+	sqlDB, err := mockDB.Open("mock")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+
+	id, err := db.Insert(context.Background(), sqlDB, "INSERT INTO users (name, age) VALUES (?, ?)", "Alice", 25)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if id != 42 {
+		t.Errorf("expected last insert id 42, got %d", id)
+	}
+
+	affected, err := db.Delete(context.Background(), sqlDB, "DELETE FROM users WHERE age > ?", 60)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if affected != 3 {
+		t.Errorf("expected 3 rows affected, got %d", affected)
+	}
+}
+
+func TestMockDB_WillReturnResultErrors(t *testing.T) {
+	mockDB := sqlmock.NewMock()
+
+	errLastInsertID := errors.New("LastInsertId is not supported")
+	errRowsAffected := errors.New("RowsAffected is not supported")
+	mockDB.ExpectQuery("INSERT INTO users (name, age) VALUES (?, ?)", "Alice", 25).
+		WillReturnLastInsertIdError(errLastInsertID)
+	mockDB.ExpectQuery("UPDATE users SET age = ? WHERE id = ?", 26, 1).
+		WillReturnRowsAffectedError(errRowsAffected)
+
+	sqlDB, err := mockDB.Open("mock")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+
+	if _, err := db.Insert(context.Background(), sqlDB, "INSERT INTO users (name, age) VALUES (?, ?)", "Alice", 25); !errors.Is(err, errLastInsertID) {
+		t.Errorf("expected %v, got %v", errLastInsertID, err)
+	}
+
+	if _, err := db.Update(context.Background(), sqlDB, "UPDATE users SET age = ? WHERE id = ?", 26, 1); !errors.Is(err, errRowsAffected) {
+		t.Errorf("expected %v, got %v", errRowsAffected, err)
+	}
+}
+
+func TestMockDB_WillReturnRowError(t *testing.T) {
+	mockDB := sqlmock.NewMock()
+
+	errRow := errors.New("connection reset")
+	mockDB.ExpectQuery("SELECT id, name, age FROM users").
+		WillReturnRows([]string{"id", "name", "age"}, [][]driver.Value{
+			{1, "John Doe", 30},
+			{2, "Alice", 25},
+		}).
+		WillReturnRowError(1, errRow)
+
+	sqlDB, err := mockDB.Open("mock")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+
+	rows, err := sqlDB.Query("SELECT id, name, age FROM users")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var users []User
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(&user.ID, &user.Name, &user.Age); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		users = append(users, user)
+	}
+
+	if len(users) != 1 {
+		t.Errorf("expected 1 user before the row error, got %d", len(users))
+	}
+	if !errors.Is(rows.Err(), errRow) {
+		t.Errorf("expected %v, got %v", errRow, rows.Err())
+	}
+}
+
+func TestMockDB_WillReturnCloseError(t *testing.T) {
+	mockDB := sqlmock.NewMock()
+
+	errClose := errors.New("close failed")
+	mockDB.ExpectQuery("SELECT id FROM users").
+		WillReturnRows([]string{"id"}, [][]driver.Value{{1}, {2}}).
+		WillReturnCloseError(errClose)
+
+	sqlDB, err := mockDB.Open("mock")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+
+	rows, err := sqlDB.Query("SELECT id FROM users")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// close before the rows are drained so the driver error is returned
+	rows.Next()
+	if err := rows.Close(); !errors.Is(err, errClose) {
+		t.Errorf("expected %v, got %v", errClose, err)
+	}
+}
+
+func TestMockDB_WillDelayFor(t *testing.T) {
+	mockDB := sqlmock.NewMock()
+
+	mockDB.ExpectQuery("SELECT id, name, age FROM users WHERE id = ?", 1).
+		WillReturnRows([]string{"id", "name", "age"}, [][]driver.Value{
+			{1, "John Doe", 30},
+		}).
+		WillDelayFor(time.Second)
+	mockDB.ExpectQuery("UPDATE users SET age = ? WHERE id = ?", 31, 1).
+		WillReturnResult(0, 1).
+		WillDelayFor(10 * time.Millisecond)
+
+	sqlDB, err := mockDB.Open("mock")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	var user User
+	err = sqlDB.QueryRowContext(ctx, "SELECT id, name, age FROM users WHERE id = ?", 1).Scan(&user.ID, &user.Name, &user.Age)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("query should be cancelled by the deadline, took %v", elapsed)
+	}
+
+	// the delay is shorter than the deadline
+	affected, err := db.Update(context.Background(), sqlDB, "UPDATE users SET age = ? WHERE id = ?", 31, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if affected != 1 {
+		t.Errorf("expected 1 row affected, got %d", affected)
+	}
+}
+
+func TestMockDB_Ping(t *testing.T) {
+	mockDB := sqlmock.NewMock()
+
+	sqlDB, err := mockDB.Open("mock")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+
+	if err := sqlDB.PingContext(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := sqlDB.PingContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+}
+
+func TestMockDB_PrepareContext(t *testing.T) {
+	mockDB := sqlmock.NewMock()
+
+	mockDB.ExpectQuery("INSERT INTO users (name, age) VALUES (?, ?)", "Alice", 25).WillReturnResult(7, 1)
+
+	sqlDB, err := mockDB.Open("mock")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+
+	stmt, err := sqlDB.PrepareContext(context.Background(), "INSERT INTO users (name, age) VALUES (?, ?)")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer stmt.Close()
+
+	result, err := stmt.ExecContext(context.Background(), "Alice", 25)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if id, _ := result.LastInsertId(); id != 7 {
+		t.Errorf("expected last insert id 7, got %d", id)
+	}
+}
@@ -0,0 +1,194 @@
+package sqlmock
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+)
+
+// ExpectedBegin represents an expected transaction begin
+type ExpectedBegin struct {
+	commonExpectation
+
+	opts *driver.TxOptions
+	err  error
+}
+
+// ExpectedCommit represents an expected transaction commit
+type ExpectedCommit struct {
+	commonExpectation
+
+	err error
+}
+
+// ExpectedRollback represents an expected transaction rollback
+type ExpectedRollback struct {
+	commonExpectation
+
+	err error
+}
+
+// ExpectBegin expects a transaction to be started.
+//
+// Without strict mode, Begin, Commit and Rollback that match no expectation succeed,
+// so tests that do not care about transactions need not declare them.
+func (m *MockDB) ExpectBegin() *ExpectedBegin {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	eb := &ExpectedBegin{commonExpectation: newCommonExpectation()}
+	m.expected = append(m.expected, eb)
+	return eb
+}
+
+// ExpectCommit expects a transaction to be committed.
+func (m *MockDB) ExpectCommit() *ExpectedCommit {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ec := &ExpectedCommit{commonExpectation: newCommonExpectation()}
+	m.expected = append(m.expected, ec)
+	return ec
+}
+
+// ExpectRollback expects a transaction to be rolled back.
+func (m *MockDB) ExpectRollback() *ExpectedRollback {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	er := &ExpectedRollback{commonExpectation: newCommonExpectation()}
+	m.expected = append(m.expected, er)
+	return er
+}
+
+// WithTxOptions sets the isolation level and read-only mode the transaction is expected to be started with.
+func (eb *ExpectedBegin) WithTxOptions(opts sql.TxOptions) *ExpectedBegin {
+	eb.opts = &driver.TxOptions{
+		Isolation: driver.IsolationLevel(opts.Isolation),
+		ReadOnly:  opts.ReadOnly,
+	}
+	return eb
+}
+
+// WillReturnError sets the error to be returned when the transaction is started
+func (eb *ExpectedBegin) WillReturnError(err error) *ExpectedBegin {
+	eb.err = err
+	return eb
+}
+
+func (eb *ExpectedBegin) String() string {
+	if eb.opts != nil {
+		return fmt.Sprintf("begin transaction with isolation %s and read-only %t",
+			sql.IsolationLevel(eb.opts.Isolation), eb.opts.ReadOnly)
+	}
+	return "begin transaction"
+}
+
+func (eb *ExpectedBegin) matches(opts driver.TxOptions) bool {
+	return eb.opts == nil || *eb.opts == opts
+}
+
+// WillReturnError sets the error to be returned when the transaction is committed
+func (ec *ExpectedCommit) WillReturnError(err error) *ExpectedCommit {
+	ec.err = err
+	return ec
+}
+
+func (ec *ExpectedCommit) String() string {
+	return "commit"
+}
+
+// WillReturnError sets the error to be returned when the transaction is rolled back
+func (er *ExpectedRollback) WillReturnError(err error) *ExpectedRollback {
+	er.err = err
+	return er
+}
+
+func (er *ExpectedRollback) String() string {
+	return "rollback"
+}
+
+// findTx returns the transaction expectation accepted by match.
+// Without strict mode a missing expectation is not an error and nil is returned.
+// The caller must hold m.mu.
+func (m *MockDB) findTx(match func(expectation) bool) (expectation, error) {
+	expected, err := m.find(match)
+	if errors.Is(err, errNoExpectation) {
+		return nil, nil
+	}
+	return expected, err
+}
+
+func (mc *MockConn) Begin() (driver.Tx, error) {
+	return mc.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (mc *MockConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	mc.mockDB.mu.Lock()
+	defer mc.mockDB.mu.Unlock()
+
+	expected, err := mc.mockDB.findTx(func(e expectation) bool {
+		eb, ok := e.(*ExpectedBegin)
+		return ok && eb.matches(opts)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unexpected begin with isolation %s and read-only %t, %w",
+			sql.IsolationLevel(opts.Isolation), opts.ReadOnly, err)
+	}
+
+	if expected != nil && expected.(*ExpectedBegin).err != nil {
+		return nil, expected.(*ExpectedBegin).err
+	}
+
+	mc.tx = &MockTx{conn: mc}
+	return mc.tx, nil
+}
+
+// MockTx implements the driver.Tx interface
+type MockTx struct {
+	conn *MockConn
+}
+
+func (mt *MockTx) Commit() error {
+	m := mt.conn.mockDB
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mt.conn.tx = nil
+
+	expected, err := m.findTx(func(e expectation) bool {
+		_, ok := e.(*ExpectedCommit)
+		return ok
+	})
+	if err != nil {
+		return fmt.Errorf("unexpected commit, %w", err)
+	}
+
+	if expected != nil {
+		return expected.(*ExpectedCommit).err
+	}
+	return nil
+}
+
+func (mt *MockTx) Rollback() error {
+	m := mt.conn.mockDB
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mt.conn.tx = nil
+
+	expected, err := m.findTx(func(e expectation) bool {
+		_, ok := e.(*ExpectedRollback)
+		return ok
+	})
+	if err != nil {
+		return fmt.Errorf("unexpected rollback, %w", err)
+	}
+
+	if expected != nil {
+		return expected.(*ExpectedRollback).err
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package sqlmock_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/smallnest/exp/db"
+	"github.com/smallnest/exp/sqlmock"
+)
+
+func TestTx_Commit(t *testing.T) {
+	mockDB := sqlmock.NewMock()
+	mockDB.MatchExpectationsInOrder(true)
+
+	mockDB.ExpectBegin()
+	mockDB.ExpectQuery("UPDATE users SET name = ? WHERE id = ?", "Bob", 1).InTx()
+	mockDB.ExpectCommit()
+
+	sqlDB, err := mockDB.Open("mock")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+
+	if _, err := db.UpdateTx(context.Background(), sqlDB, "UPDATE users SET name = ? WHERE id = ?", "Bob", 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := mockDB.ExpectationsWereMet(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestTx_Rollback(t *testing.T) {
+	mockDB := sqlmock.NewMock()
+	mockDB.MatchExpectationsInOrder(true)
+
+	errInsert := errors.New("duplicate key")
+	mockDB.ExpectBegin()
+	mockDB.ExpectQuery("INSERT INTO users (name, age) VALUES (?, ?)", "Alice", 25).
+		InTx().
+		WillReturnError(nil, errInsert)
+	mockDB.ExpectRollback()
+
+	sqlDB, err := mockDB.Open("mock")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+
+	_, err = db.InsertTx(context.Background(), sqlDB, "INSERT INTO users (name, age) VALUES (?, ?)", "Alice", 25)
+	if !errors.Is(err, errInsert) {
+		t.Fatalf("expected %v, got %v", errInsert, err)
+	}
+
+	if err := mockDB.ExpectationsWereMet(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestTx_CommitExpectedButRolledBack(t *testing.T) {
+	mockDB := sqlmock.NewMock()
+
+	mockDB.ExpectBegin()
+	mockDB.ExpectCommit()
+
+	sqlDB, err := mockDB.Open("mock")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+
+	tx, err := sqlDB.Begin()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := mockDB.ExpectationsWereMet(); err == nil {
+		t.Errorf("expected unmet commit, got nil")
+	}
+}
+
+func TestTx_Errors(t *testing.T) {
+	mockDB := sqlmock.NewMock()
+
+	errBegin := errors.New("begin failed")
+	errCommit := errors.New("commit failed")
+	mockDB.ExpectBegin().WillReturnError(errBegin)
+	mockDB.ExpectBegin()
+	mockDB.ExpectCommit().WillReturnError(errCommit)
+
+	sqlDB, err := mockDB.Open("mock")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+
+	if _, err := sqlDB.Begin(); !errors.Is(err, errBegin) {
+		t.Fatalf("expected %v, got %v", errBegin, err)
+	}
+
+	tx, err := sqlDB.Begin()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := tx.Commit(); !errors.Is(err, errCommit) {
+		t.Fatalf("expected %v, got %v", errCommit, err)
+	}
+
+	if err := mockDB.ExpectationsWereMet(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestTx_Options(t *testing.T) {
+	mockDB := sqlmock.NewMock()
+	mockDB.MatchExpectationsInOrder(true)
+
+	mockDB.ExpectBegin().WithTxOptions(sql.TxOptions{Isolation: sql.LevelSerializable, ReadOnly: true})
+	mockDB.ExpectRollback()
+
+	sqlDB, err := mockDB.Open("mock")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+
+	if _, err := sqlDB.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelReadCommitted}); err == nil {
+		t.Fatalf("expected error for unexpected isolation level, got nil")
+	}
+
+	tx, err := sqlDB.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelSerializable, ReadOnly: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := mockDB.ExpectationsWereMet(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestTx_NotInTx(t *testing.T) {
+	mockDB := sqlmock.NewMock()
+
+	mockDB.ExpectQuery("DELETE FROM users WHERE id = ?", 1).NotInTx()
+
+	sqlDB, err := mockDB.Open("mock")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+
+	tx, err := sqlDB.Begin()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := tx.Exec("DELETE FROM users WHERE id = ?", 1); err == nil {
+		t.Fatalf("expected error for query inside transaction, got nil")
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := sqlDB.Exec("DELETE FROM users WHERE id = ?", 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := mockDB.ExpectationsWereMet(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}